@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -15,12 +16,15 @@ type CommandHandler func(args []string, stdout, stderr io.Writer) error
 type Registry struct {
 	commands      map[string]CommandHandler
 	commandFinder func(string) string
+	hashLookup    func(string) (string, bool)
+	exitHandler   func(int)
 }
 
 // NewRegistry creates a new built-in command registry
 func NewRegistry(stdout, stderr io.Writer) *Registry {
 	r := &Registry{
-		commands: make(map[string]CommandHandler),
+		commands:    make(map[string]CommandHandler),
+		exitHandler: os.Exit,
 	}
 	r.registerDefaults()
 	return r
@@ -31,6 +35,16 @@ func (r *Registry) SetCommandFinder(finder func(string) string) {
 	r.commandFinder = finder
 }
 
+// SetHashLookup sets the function used to find commands remembered in the shell's hash table
+func (r *Registry) SetHashLookup(lookup func(string) (string, bool)) {
+	r.hashLookup = lookup
+}
+
+// SetExitHandler sets the function the exit command uses to terminate the shell
+func (r *Registry) SetExitHandler(handler func(int)) {
+	r.exitHandler = handler
+}
+
 // IsBuiltin checks if a command is a built-in command
 func (r *Registry) IsBuiltin(cmd string) bool {
 	_, exists := r.commands[cmd]
@@ -46,6 +60,16 @@ func (r *Registry) Execute(cmd string, args []string, stdout, stderr io.Writer)
 	return handler(args, stdout, stderr)
 }
 
+// Names returns the names of all built-in commands in sorted order
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.commands))
+	for name := range r.commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 // Register registers a new built-in command
 func (r *Registry) Register(cmd string, handler CommandHandler) {
 	r.commands[cmd] = handler
@@ -63,7 +87,7 @@ func (r *Registry) registerDefaults() {
 // handleExit handles the 'exit' built-in command
 func (r *Registry) handleExit(args []string, stdout, stderr io.Writer) error {
 	if len(args) == 0 {
-		os.Exit(0)
+		r.exitHandler(0)
 		return nil
 	}
 	exitCode, err := strconv.Atoi(args[0])
@@ -71,7 +95,7 @@ func (r *Registry) handleExit(args []string, stdout, stderr io.Writer) error {
 		fmt.Fprintf(stderr, "exit: invalid exit code: %s\n", args[0])
 		return err
 	}
-	os.Exit(exitCode)
+	r.exitHandler(exitCode)
 	return nil
 }
 
@@ -130,6 +154,13 @@ func (r *Registry) handleType(args []string, stdout, stderr io.Writer) error {
 		return nil
 	}
 
+	if r.hashLookup != nil {
+		if hashedPath, ok := r.hashLookup(cmdName); ok {
+			fmt.Fprintln(stdout, cmdName+" is hashed ("+hashedPath+")")
+			return nil
+		}
+	}
+
 	if r.commandFinder == nil {
 		fmt.Fprintf(stderr, "type: command finder not configured\n")
 		fmt.Fprintln(stdout, cmdName+": not found")
@@ -2,6 +2,7 @@ package errors
 
 import (
 	"fmt"
+	"strings"
 )
 
 // ShellError is the base interface for all shell-specific errors
@@ -13,9 +14,14 @@ type ShellError interface {
 // CommandNotFoundError represents an error when a command cannot be found
 type CommandNotFoundError struct {
 	Command string
+	// Suggestions are existing commands with similar names
+	Suggestions []string
 }
 
 func (e CommandNotFoundError) Error() string {
+	if len(e.Suggestions) > 0 {
+		return fmt.Sprintf("%s: command not found. Did you mean: %s?", e.Command, strings.Join(e.Suggestions, ", "))
+	}
 	return fmt.Sprintf("%s: command not found", e.Command)
 }
 
@@ -37,6 +43,42 @@ func (e CommandFailedError) ShellError() string {
 	return "command_failed"
 }
 
+// CommandExecError represents an error when a command exists but cannot be executed,
+// or is named by a path that does not exist
+type CommandExecError struct {
+	Command string
+	Reason  string
+	// Status is the exit status reported for the command: 127 if it does not exist, 126 otherwise
+	Status int
+}
+
+func (e CommandExecError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Command, e.Reason)
+}
+
+func (e CommandExecError) ShellError() string {
+	return "command_exec_failed"
+}
+
+// RestrictedError represents an operation refused because the shell is in restricted mode
+type RestrictedError struct {
+	// Target is the command, variable or file the operation was applied to
+	Target string
+	// Reason explains the restriction, or is empty when the operation is refused entirely
+	Reason string
+}
+
+func (e RestrictedError) Error() string {
+	if e.Reason == "" {
+		return fmt.Sprintf("%s: restricted", e.Target)
+	}
+	return fmt.Sprintf("%s: restricted: %s", e.Target, e.Reason)
+}
+
+func (e RestrictedError) ShellError() string {
+	return "restricted"
+}
+
 // ParseError represents an error during command parsing
 type ParseError struct {
 	Message string
@@ -84,6 +126,29 @@ func NewCommandNotFoundError(cmd string) CommandNotFoundError {
 	return CommandNotFoundError{Command: cmd}
 }
 
+// NewCommandNotFoundErrorWithSuggestions creates a new command not found error
+// that suggests commands the user may have meant
+func NewCommandNotFoundErrorWithSuggestions(cmd string, suggestions []string) CommandNotFoundError {
+	return CommandNotFoundError{Command: cmd, Suggestions: suggestions}
+}
+
+// NewCommandExecError creates a new command exec error
+func NewCommandExecError(cmd, reason string, status int) CommandExecError {
+	return CommandExecError{
+		Command: cmd,
+		Reason:  reason,
+		Status:  status,
+	}
+}
+
+// NewRestrictedError creates a new restricted mode error
+func NewRestrictedError(target, reason string) RestrictedError {
+	return RestrictedError{
+		Target: target,
+		Reason: reason,
+	}
+}
+
 // NewCommandFailedError creates a new command failed error
 func NewCommandFailedError(cmd, reason string) CommandFailedError {
 	return CommandFailedError{
@@ -0,0 +1,91 @@
+package executor
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CommandIndex lists the executables found in PATH. The directories are only read
+// when the list is first needed, and again after PATH or one of its directories changes.
+type CommandIndex struct {
+	mu    sync.Mutex
+	names []string
+	// path is the value of PATH the names are read from. It starts as the process's
+	// PATH; a shell keeps it in step with its own PATH variable, as for HashTable.
+	path string
+	// modTimes are the modification times the directories had when they were read
+	modTimes map[string]time.Time
+	scanned  bool
+}
+
+// NewCommandIndex creates an index that has not read PATH yet
+func NewCommandIndex() *CommandIndex {
+	return &CommandIndex{path: os.Getenv("PATH")}
+}
+
+// SetPath sets the value of PATH the names are read from
+func (c *CommandIndex) SetPath(path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if path != c.path {
+		c.path = path
+		c.scanned = false
+	}
+}
+
+// Names returns the names of the executables in PATH, sorted and without duplicates
+func (c *CommandIndex) Names() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.scanned || c.dirsChanged() {
+		c.scan()
+	}
+	return c.names
+}
+
+// dirsChanged reports whether a directory has been modified since it was read.
+// The caller must hold c.mu.
+func (c *CommandIndex) dirsChanged() bool {
+	for dir, modTime := range c.modTimes {
+		info, err := os.Stat(dir)
+		if err != nil || !info.ModTime().Equal(modTime) {
+			return true
+		}
+	}
+	return false
+}
+
+// scan reads the executables in the directories of PATH. The caller must hold c.mu.
+func (c *CommandIndex) scan() {
+	seen := make(map[string]bool)
+	c.names = nil
+	c.modTimes = make(map[string]time.Time)
+	for _, dir := range filepath.SplitList(c.path) {
+		if dir == "" {
+			// As in GetCommand, an empty entry is the current directory
+			dir = "."
+		}
+		if info, err := os.Stat(dir); err == nil {
+			c.modTimes[dir] = info.ModTime()
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if seen[name] || strings.HasPrefix(name, ".") || !isExecutable(filepath.Join(dir, name)) {
+				continue
+			}
+			seen[name] = true
+			c.names = append(c.names, name)
+		}
+	}
+	sort.Strings(c.names)
+	c.scanned = true
+}
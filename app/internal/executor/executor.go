@@ -1,19 +1,34 @@
 package executor
 
 import (
+	stderrors "errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/codecrafters-io/shell-starter-go/app/internal/errors"
 )
 
 // GetCommand finds the full path of an executable command in the PATH.
+// Names containing a slash are not searched for; they are returned if they name an executable file.
 func GetCommand(commandName string) string {
-	pathsEnv := os.Getenv("PATH")
+	return SearchPath(commandName, os.Getenv("PATH"))
+}
+
+// SearchPath is GetCommand with the list of directories given as pathsEnv, for a
+// shell whose PATH variable is not the process's
+func SearchPath(commandName, pathsEnv string) string {
+	if strings.Contains(commandName, "/") {
+		if isExecutable(commandName) {
+			return commandName
+		}
+		return ""
+	}
 	if pathsEnv == "" {
 		return ""
 	}
@@ -29,11 +44,8 @@ func GetCommand(commandName string) string {
 			dir = "." // Match original behavior
 		}
 		fullPath := filepath.Join(dir, commandName)
-		fileInfo, err := os.Stat(fullPath)
-		if err == nil {
-			if !fileInfo.IsDir() && (fileInfo.Mode().Perm()&0111 != 0) { // Check if executable
-				return fullPath
-			}
+		if isExecutable(fullPath) {
+			return fullPath
 		}
 	}
 	return ""
@@ -45,28 +57,178 @@ func HandleExternalCommand(command string, args []string) {
 }
 
 // HandleExternalCommandWithIO executes an external command with custom IO streams.
-func HandleExternalCommandWithIO(command string, args []string, stdin io.Reader, stdout, stderr io.Writer) {
-	foundPath := GetCommand(command)
-	if foundPath != "" {
-		// keep using command, because test case assert command is first argument
-		cmd := exec.Command(command, args...)
-		cmd.Stdin = stdin
-		cmd.Stdout = stdout
-		cmd.Stderr = stderr
-		err := cmd.Run()
-		if err != nil {
-			if exitErr, ok := err.(*exec.ExitError); ok {
-				// Command ran but exited non-zero. Output is already on Stderr by the command itself.
-				// We don't need to print an additional error message for this case.
-				_ = exitErr // Suppress unused variable warning
-			} else {
-				// This error means the command failed to start
-				shellErr := errors.NewCommandFailedError(command, err.Error())
-				fmt.Fprintf(stderr, "%s\n", shellErr.Error())
-			}
+func HandleExternalCommandWithIO(command string, args []string, stdin io.Reader, stdout, stderr io.Writer) ExecResult {
+	path, err := ResolveCommand(command)
+	if err != nil {
+		return reportError(stderr, err)
+	}
+	return runExternalCommand(path, command, args, nil, stdin, stdout, stderr, DefaultScriptInterpreter)
+}
+
+// ResolveCommand returns the path of the program a command name refers to. Names
+// containing a slash are used as paths directly; other names are searched in PATH.
+// The error tells why a path cannot be executed, and carries the matching exit status.
+func ResolveCommand(commandName string) (string, error) {
+	if !strings.Contains(commandName, "/") {
+		if path := GetCommand(commandName); path != "" {
+			return path, nil
+		}
+		return "", errors.NewCommandNotFoundError(commandName)
+	}
+
+	info, err := os.Stat(commandName)
+	switch {
+	case err != nil:
+		return "", execError(commandName, err)
+	case info.IsDir():
+		return "", errors.NewCommandExecError(commandName, "Is a directory", 126)
+	case syscall.Access(commandName, accessExecute) != nil:
+		return "", errors.NewCommandExecError(commandName, "Permission denied", 126)
+	}
+	return commandName, nil
+}
+
+// accessExecute is the X_OK mode of access(2)
+const accessExecute = 1
+
+// execError converts an error from looking up or starting a program into a shell error:
+// a missing file has status 127 and any other problem 126
+func execError(command string, err error) error {
+	switch {
+	case stderrors.Is(err, syscall.ENOENT):
+		return errors.NewCommandExecError(command, "No such file or directory", 127)
+	case stderrors.Is(err, syscall.ENOTDIR):
+		return errors.NewCommandExecError(command, "Not a directory", 126)
+	case stderrors.Is(err, syscall.EACCES):
+		return errors.NewCommandExecError(command, "Permission denied", 126)
+	}
+	return errors.NewCommandFailedError(command, err.Error())
+}
+
+// ExitStatus returns the exit status for a command that could not be run
+func ExitStatus(err error) int {
+	switch err := err.(type) {
+	case errors.CommandNotFoundError:
+		return 127
+	case errors.CommandExecError:
+		return err.Status
+	}
+	return 126
+}
+
+// reportError prints why a command could not be run and returns the matching result
+func reportError(stderr io.Writer, err error) ExecResult {
+	fmt.Fprintf(stderr, "%s\n", err.Error())
+	return errorResult(ExitStatus(err), err)
+}
+
+// runExternalCommand runs the program at path and waits for it to finish.
+// A nil env runs the program with the shell's own environment.
+func runExternalCommand(path, command string, args, env []string, stdin io.Reader, stdout, stderr io.Writer, interpreter string) ExecResult {
+	return runPrepared(newCommand(path, command, args), command, env, stdin, stdout, stderr, interpreter)
+}
+
+// runPrepared runs a command prepared by newCommand or a wrapper of it and waits for it to finish
+func runPrepared(cmd *exec.Cmd, command string, env []string, stdin io.Reader, stdout, stderr io.Writer, interpreter string) ExecResult {
+	cmd.Env = env
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	start := time.Now()
+	cmd, err := startCommand(cmd, interpreter)
+	if err != nil {
+		// This error means the command failed to start
+		return reportError(stderr, execError(command, err))
+	}
+	cmd.Wait()
+	// The command ran. If it exited non-zero, its output is already on Stderr
+	// and we don't need to print an additional error message.
+	return processResult(cmd.ProcessState, time.Since(start))
+}
+
+// StartExternalCommandWithIO starts an external command without waiting for it to finish.
+// The command is placed in its own process group so it can be managed as a job.
+// If tty is a terminal file descriptor (not -1), the new process group is made its
+// foreground group, so that keyboard signals such as Ctrl-C go to the command.
+func StartExternalCommandWithIO(command string, args []string, stdin io.Reader, stdout, stderr io.Writer, tty int) (*exec.Cmd, error) {
+	path, err := ResolveCommand(command)
+	if err != nil {
+		return nil, err
+	}
+	return startExternalCommand(path, command, args, nil, stdin, stdout, stderr, tty, DefaultScriptInterpreter)
+}
+
+// startExternalCommand starts the program at path in its own process group.
+// A nil env runs the program with the shell's own environment.
+func startExternalCommand(path, command string, args, env []string, stdin io.Reader, stdout, stderr io.Writer, tty int, interpreter string) (*exec.Cmd, error) {
+	return startPrepared(newCommand(path, command, args), command, env, stdin, stdout, stderr, tty, interpreter)
+}
+
+// startPrepared starts a command prepared by newCommand or a wrapper of it in its own
+// process group, keeping any other process attributes the command already has
+func startPrepared(cmd *exec.Cmd, command string, env []string, stdin io.Reader, stdout, stderr io.Writer, tty int, interpreter string) (*exec.Cmd, error) {
+	cmd.Env = env
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+	if tty >= 0 {
+		cmd.SysProcAttr.Foreground = true
+		cmd.SysProcAttr.Ctty = tty
+	}
+	cmd, err := startCommand(cmd, interpreter)
+	if err != nil {
+		return nil, execError(command, err)
+	}
+	return cmd, nil
+}
+
+// DefaultScriptInterpreter runs executable files without a "#!" line unless the
+// executor is configured to use another shell
+const DefaultScriptInterpreter = "/bin/sh"
+
+// startCommand starts cmd. An executable file the kernel does not recognize, such as
+// a script without a "#!" line, is run as a shell script by the interpreter, as POSIX
+// requires; the returned command is the one that was started.
+func startCommand(cmd *exec.Cmd, interpreter string) (*exec.Cmd, error) {
+	err := cmd.Start()
+	if err == nil || interpreter == "" || !stderrors.Is(err, syscall.ENOEXEC) {
+		return cmd, err
+	}
+
+	script := exec.Command(interpreter, append([]string{cmd.Path}, cmd.Args[1:]...)...)
+	script.Stdin = cmd.Stdin
+	script.Stdout = cmd.Stdout
+	script.Stderr = cmd.Stderr
+	script.Env = cmd.Env
+	script.Dir = cmd.Dir
+	script.ExtraFiles = cmd.ExtraFiles
+	script.SysProcAttr = cmd.SysProcAttr
+	return script, script.Start()
+}
+
+// newCommand prepares a command that runs the program at path. argv[0] stays the
+// name the user typed, as test cases assert, and path is used as found so the
+// program is not searched for in PATH a second time.
+func newCommand(path, command string, args []string) *exec.Cmd {
+	cmd := exec.Command(path, args...)
+	cmd.Args[0] = command
+	return cmd
+}
+
+// WaitProcess waits until the process exits, is killed or is stopped, and returns its status
+// and resource usage. Unlike exec.Cmd.Wait it also reports stops, which job control needs
+// to notice Ctrl-Z.
+func WaitProcess(pid int) (syscall.WaitStatus, *syscall.Rusage, error) {
+	var status syscall.WaitStatus
+	var usage syscall.Rusage
+	for {
+		_, err := syscall.Wait4(pid, &status, syscall.WUNTRACED, &usage)
+		if err != syscall.EINTR {
+			return status, &usage, err
 		}
-	} else {
-		shellErr := errors.NewCommandNotFoundError(command)
-		fmt.Fprintf(stderr, "%s\n", shellErr.Error())
 	}
 }
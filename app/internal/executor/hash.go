@@ -0,0 +1,166 @@
+package executor
+
+import (
+	"os"
+	"sort"
+	"sync"
+)
+
+// HashEntry is a command remembered by the hash table
+type HashEntry struct {
+	Name string
+	Path string
+	// Hits counts how many times the entry was used to run the command
+	Hits int
+}
+
+// HashTable caches the PATH lookups of commands, so that running a command
+// does not search every PATH directory each time. The table is emptied when
+// PATH changes, and an entry whose file has disappeared is looked up again.
+type HashTable struct {
+	mu      sync.Mutex
+	entries map[string]*HashEntry
+	// path is the value of PATH commands are searched in. It starts as the
+	// process's PATH; a shell keeps it in step with its own PATH variable.
+	path string
+}
+
+// NewHashTable creates an empty hash table
+func NewHashTable() *HashTable {
+	return &HashTable{
+		entries: make(map[string]*HashEntry),
+		path:    os.Getenv("PATH"),
+	}
+}
+
+// SetPath sets the value of PATH commands are searched in, emptying the table if it changed
+func (t *HashTable) SetPath(path string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if path != t.path {
+		t.entries = make(map[string]*HashEntry)
+		t.path = path
+	}
+}
+
+// Search searches PATH for a command without remembering it
+func (t *HashTable) Search(name string) string {
+	t.mu.Lock()
+	path := t.path
+	t.mu.Unlock()
+	return SearchPath(name, path)
+}
+
+// Lookup returns the path a command should run from and counts a hit.
+// Commands that are not hashed yet are searched in PATH and remembered.
+func (t *HashTable) Lookup(name string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entry := t.find(name)
+	if entry == nil {
+		return ""
+	}
+	entry.Hits++
+	return entry.Path
+}
+
+// Find returns the path a command would run from, like Lookup, but without
+// counting a hit, so that checking for a command before running it remembers
+// the command and running it does not search PATH again
+func (t *HashTable) Find(name string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if entry := t.find(name); entry != nil {
+		return entry.Path
+	}
+	return ""
+}
+
+// find returns the entry of a command, searching PATH if it is not hashed or its
+// file has disappeared, or nil if the command was not found. The caller must hold t.mu.
+func (t *HashTable) find(name string) *HashEntry {
+	entry, ok := t.entries[name]
+	if !ok || !isExecutable(entry.Path) {
+		path := SearchPath(name, t.path)
+		if path == "" {
+			delete(t.entries, name)
+			return nil
+		}
+		entry = &HashEntry{Name: name, Path: path}
+		t.entries[name] = entry
+	}
+	return entry
+}
+
+// Hash searches PATH for a command and remembers it, resetting its hit count.
+// It returns false if the command was not found.
+func (t *HashTable) Hash(name string) (string, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	path := SearchPath(name, t.path)
+	if path == "" {
+		return "", false
+	}
+	t.entries[name] = &HashEntry{Name: name, Path: path}
+	return path, true
+}
+
+// Add remembers path as the location of a command without searching PATH
+func (t *HashTable) Add(name, path string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.entries[name] = &HashEntry{Name: name, Path: path}
+}
+
+// Get returns the remembered path of a command
+func (t *HashTable) Get(name string) (string, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entry, ok := t.entries[name]
+	if !ok {
+		return "", false
+	}
+	return entry.Path, true
+}
+
+// Delete forgets a command and reports whether it was remembered
+func (t *HashTable) Delete(name string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	_, ok := t.entries[name]
+	delete(t.entries, name)
+	return ok
+}
+
+// Clear forgets all commands
+func (t *HashTable) Clear() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.entries = make(map[string]*HashEntry)
+}
+
+// Entries returns a copy of the remembered commands sorted by name
+func (t *HashTable) Entries() []HashEntry {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entries := make([]HashEntry, 0, len(t.entries))
+	for _, entry := range t.entries {
+		entries = append(entries, *entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name < entries[j].Name
+	})
+	return entries
+}
+
+// isExecutable reports whether path is an executable regular file
+func isExecutable(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir() && info.Mode().Perm()&0111 != 0
+}
@@ -0,0 +1,262 @@
+package executor
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/codecrafters-io/shell-starter-go/app/internal/errors"
+)
+
+// WindowSize is the size of a terminal in character cells
+type WindowSize struct {
+	Rows uint16
+	Cols uint16
+}
+
+// defaultWindowSize is the size of pseudo-terminals when the shell has no terminal to copy it from
+var defaultWindowSize = WindowSize{Rows: 24, Cols: 80}
+
+// pseudoTerminals runs commands on pseudo-terminals of a common size, and keeps
+// track of the terminals in use so that a size change reaches running commands
+type pseudoTerminals struct {
+	mu     sync.Mutex
+	size   WindowSize
+	active map[*os.File]bool
+}
+
+// newPseudoTerminals creates pseudo-terminals the size of the process's own terminal, if it has one
+func newPseudoTerminals() *pseudoTerminals {
+	size := defaultWindowSize
+	for _, f := range []*os.File{os.Stdout, os.Stdin} {
+		if s, err := getWindowSize(f); err == nil && s.Rows > 0 && s.Cols > 0 {
+			size = s
+			break
+		}
+	}
+	return &pseudoTerminals{size: size, active: make(map[*os.File]bool)}
+}
+
+// resize changes the size of all pseudo-terminals. The kernel sends SIGWINCH to
+// the commands running on the ones in use.
+func (p *pseudoTerminals) resize(size WindowSize) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.size = size
+	for master := range p.active {
+		setWindowSize(master, size)
+	}
+}
+
+// open allocates a pseudo-terminal of the current size and returns its master and slave ends
+func (p *pseudoTerminals) open() (master, slave *os.File, err error) {
+	master, slave, err = openPTY()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	setWindowSize(master, p.size)
+	p.active[master] = true
+	return master, slave, nil
+}
+
+// close releases a pseudo-terminal allocated by open
+func (p *pseudoTerminals) close(master *os.File) {
+	p.mu.Lock()
+	delete(p.active, master)
+	p.mu.Unlock()
+	master.Close()
+}
+
+// run runs a command prepared by newCommand with its standard input and output on a
+// new pseudo-terminal, which becomes its controlling terminal, and waits for it to
+// finish. The terminal's output is copied to stdout, and stdin, if not nil, is
+// typed into it followed by Ctrl-D until the command exits. Standard error stays
+// separate, so it is not a terminal.
+func (p *pseudoTerminals) run(cmd *exec.Cmd, command string, env []string, stdin io.Reader, stdout, stderr io.Writer, interpreter string) ExecResult {
+	master, slave, err := p.open()
+	if err != nil {
+		return reportError(stderr, errors.NewCommandFailedError(command, "cannot allocate a pseudo-terminal: "+err.Error()))
+	}
+	defer p.close(master)
+
+	cmd.Env = env
+	cmd.Stdout = slave
+	cmd.Stderr = stderr
+	ctty := 1
+	if stdin != nil {
+		cmd.Stdin = slave
+		ctty = 0
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true, Ctty: ctty}
+
+	stopTyping := func() {}
+	if stdin != nil {
+		if stopTyping, err = startTyping(master, stdin); err != nil {
+			slave.Close()
+			return reportError(stderr, errors.NewCommandFailedError(command, err.Error()))
+		}
+	}
+
+	start := time.Now()
+	cmd, err = startCommand(cmd, interpreter)
+	// Only the command keeps the slave open, so reading the master ends when it exits
+	slave.Close()
+	if err != nil {
+		stopTyping()
+		return reportError(stderr, execError(command, err))
+	}
+
+	copied := make(chan struct{})
+	go func() {
+		io.Copy(stdout, master)
+		close(copied)
+	}()
+	cmd.Wait()
+	stopTyping()
+	<-copied
+	return processResult(cmd.ProcessState, time.Since(start))
+}
+
+// startTyping starts typing input into a terminal, and returns a function that stops
+// it, for when the command exits; input read after that would be lost to the shell.
+// A file is polled together with a pipe the stop function closes, so that typing stops
+// even while waiting for input. Other readers, such as an embedder's buffers, cannot be
+// polled; a read already waiting on them when the command exits is not interrupted.
+func startTyping(master *os.File, input io.Reader) (stop func(), err error) {
+	stopReader, stopWriter, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+
+	typed := make(chan struct{})
+	go func() {
+		typeInput(master, input, stopReader)
+		stopReader.Close()
+		close(typed)
+	}()
+	return func() {
+		stopWriter.Close()
+		if _, ok := input.(*os.File); ok {
+			<-typed
+		}
+	}, nil
+}
+
+// typeInput writes input to a terminal and then ends it as a user would, with Ctrl-D.
+// It gives up without ending the input once stop becomes readable.
+func typeInput(master *os.File, input io.Reader, stop *os.File) {
+	last := byte('\n')
+	buf := make([]byte, 4096)
+	for {
+		if !waitInput(input, stop) {
+			return
+		}
+		n, err := input.Read(buf)
+		if n > 0 {
+			if _, err := master.Write(buf[:n]); err != nil {
+				return
+			}
+			last = buf[n-1]
+		}
+		if err != nil {
+			break
+		}
+	}
+	// Ctrl-D only signals the end of input at the start of a line;
+	// elsewhere it first hands over the partial line
+	if last != '\n' {
+		master.Write([]byte{4})
+	}
+	master.Write([]byte{4})
+}
+
+// pollFd is the kernel's struct pollfd
+type pollFd struct {
+	fd      int32
+	events  int16
+	revents int16
+}
+
+// pollIn is the poll event of a descriptor with data to read
+const pollIn = 0x1
+
+// waitInput waits until input can be read without blocking, if it is a file, and
+// reports whether that happened before stop became readable
+func waitInput(input io.Reader, stop *os.File) bool {
+	fds := []pollFd{{fd: int32(stop.Fd()), events: pollIn}}
+	// Without a file to wait for, stop is only checked
+	timeout := unsafe.Pointer(&syscall.Timespec{})
+	if f, ok := input.(*os.File); ok {
+		fds = append(fds, pollFd{fd: int32(f.Fd()), events: pollIn})
+		timeout = nil
+	}
+	for {
+		_, _, errno := syscall.Syscall6(syscall.SYS_PPOLL, uintptr(unsafe.Pointer(&fds[0])), uintptr(len(fds)), uintptr(timeout), 0, 0, 0)
+		if errno != syscall.EINTR {
+			return fds[0].revents == 0
+		}
+	}
+}
+
+// openPTY allocates a pseudo-terminal pair through /dev/ptmx
+func openPTY() (master, slave *os.File, err error) {
+	master, err = os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var unlock int32
+	if err := ioctl(master, syscall.TIOCSPTLCK, unsafe.Pointer(&unlock)); err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+	var n uint32
+	if err := ioctl(master, syscall.TIOCGPTN, unsafe.Pointer(&n)); err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+
+	slave, err = os.OpenFile("/dev/pts/"+strconv.FormatUint(uint64(n), 10), os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+	return master, slave, nil
+}
+
+// winsize is the kernel's struct winsize
+type winsize struct {
+	rows, cols, xpixel, ypixel uint16
+}
+
+// getWindowSize returns the size of the terminal f
+func getWindowSize(f *os.File) (WindowSize, error) {
+	var ws winsize
+	if err := ioctl(f, syscall.TIOCGWINSZ, unsafe.Pointer(&ws)); err != nil {
+		return WindowSize{}, err
+	}
+	return WindowSize{Rows: ws.rows, Cols: ws.cols}, nil
+}
+
+// setWindowSize sets the size of the terminal f
+func setWindowSize(f *os.File, size WindowSize) error {
+	ws := winsize{rows: size.Rows, cols: size.Cols}
+	return ioctl(f, syscall.TIOCSWINSZ, unsafe.Pointer(&ws))
+}
+
+// ioctl performs a terminal ioctl whose argument is a pointer
+func ioctl(f *os.File, request uintptr, arg unsafe.Pointer) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), request, uintptr(arg))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package executor
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// ExecResult describes how an external command ended and the resources it used
+type ExecResult struct {
+	// ExitCode is the command's exit status, 128+n if it was killed by signal n,
+	// 127 if it was not found and 126 if it could not be started
+	ExitCode int
+	// Signal is the signal that killed the command, or 0 if it exited
+	Signal     syscall.Signal
+	CoreDumped bool
+	// Err is set when the command could not be run at all
+	Err error
+
+	WallTime time.Duration
+	UserTime time.Duration
+	SysTime  time.Duration
+	// MaxRSS is the peak resident set size in kilobytes
+	MaxRSS int64
+}
+
+// Success reports whether the command ran and exited with status 0
+func (r ExecResult) Success() bool {
+	return r.ExitCode == 0
+}
+
+// NewExecResult builds the result of a command that was waited for, from its wait status and resource usage
+func NewExecResult(status syscall.WaitStatus, usage *syscall.Rusage, wall time.Duration) ExecResult {
+	result := ExecResult{ExitCode: status.ExitStatus(), WallTime: wall}
+	if status.Signaled() {
+		result.Signal = status.Signal()
+		result.ExitCode = 128 + int(result.Signal)
+		result.CoreDumped = status.CoreDump()
+	}
+	if usage != nil {
+		result.UserTime = time.Duration(usage.Utime.Nano())
+		result.SysTime = time.Duration(usage.Stime.Nano())
+		result.MaxRSS = usage.Maxrss
+	}
+	return result
+}
+
+// processResult builds the result of a command from the state exec.Cmd recorded for it
+func processResult(state *os.ProcessState, wall time.Duration) ExecResult {
+	status, _ := state.Sys().(syscall.WaitStatus)
+	usage, _ := state.SysUsage().(*syscall.Rusage)
+	return NewExecResult(status, usage, wall)
+}
+
+// errorResult builds the result of a command that could not be run
+func errorResult(exitCode int, err error) ExecResult {
+	return ExecResult{ExitCode: exitCode, Err: err}
+}
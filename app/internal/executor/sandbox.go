@@ -0,0 +1,427 @@
+package executor
+
+import (
+	stderrors "errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// DefaultSandboxMounts are the host directories visible, read-only, inside the sandbox
+var DefaultSandboxMounts = []string{"/bin", "/sbin", "/usr", "/lib", "/lib32", "/lib64", "/etc"}
+
+// sandboxDevices are the device nodes available inside the sandbox. The rest of /dev
+// is left out, since the sandbox may be root over host devices when the shell is.
+var sandboxDevices = []string{"/dev/null", "/dev/zero", "/dev/full", "/dev/random", "/dev/urandom"}
+
+// SandboxInitArg is the first argument that makes the shell binary set up a sandbox
+// and run a command in it, see SandboxInit
+const SandboxInitArg = "__sandbox_init"
+
+// sandboxRoot is where the sandbox's root file system is assembled before it becomes
+// the root. Mounting over it only affects the sandbox's own mount namespace.
+const sandboxRoot = "/tmp"
+
+// SandboxService runs each external command in new user, mount, pid and network
+// namespaces. The command sees a read-only view of the configured host directories
+// and of the current directory, a private /tmp and no network. It runs as root
+// inside the sandbox, mapped to the shell's user outside.
+//
+// A process cannot set up mounts between clone and exec in Go, so the shell binary
+// is started again inside the namespaces with SandboxInitArg to prepare them.
+type SandboxService struct {
+	*Service
+	// mounts are host paths bind-mounted read-only at the same location
+	mounts []string
+	// helper is the program that prepares the sandbox, normally the shell itself
+	helper string
+}
+
+// NewSandboxService creates an executor that runs commands in a sandbox where the
+// given host paths are visible read-only
+func NewSandboxService(mounts []string) (*SandboxService, error) {
+	helper, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("sandbox: %w", err)
+	}
+	return &SandboxService{Service: NewService(), mounts: mounts, helper: helper}, nil
+}
+
+// Execute executes an external command in the sandbox with the provided IO streams
+func (s *SandboxService) Execute(command string, args []string, stdin io.Reader, stdout, stderr io.Writer) ExecResult {
+	return s.ExecuteWithEnv(command, args, nil, stdin, stdout, stderr)
+}
+
+// ExecuteWithEnv executes an external command in the sandbox with the given environment
+func (s *SandboxService) ExecuteWithEnv(command string, args, env []string, stdin io.Reader, stdout, stderr io.Writer) ExecResult {
+	path, err := s.resolve(command)
+	if err != nil {
+		return reportError(stderr, err)
+	}
+	// The helper runs scripts without a "#!" line itself, inside the sandbox
+	return runPrepared(s.command(path, command, args), command, env, stdin, stdout, stderr, "")
+}
+
+// Start starts an external command in the sandbox without waiting for it
+func (s *SandboxService) Start(command string, args, env []string, stdin io.Reader, stdout, stderr io.Writer, tty int) (*exec.Cmd, error) {
+	path, err := s.resolve(command)
+	if err != nil {
+		return nil, err
+	}
+	return startPrepared(s.command(path, command, args), command, env, stdin, stdout, stderr, tty, "")
+}
+
+// Exec runs the program at path in the sandbox with the process's standard streams
+// and exits with its status. A process cannot move itself into new namespaces, so
+// unlike Service.Exec the shell waits for the program instead of becoming it.
+func (s *SandboxService) Exec(path string, argv, env []string) error {
+	result := runPrepared(s.command(path, argv[0], argv[1:]), argv[0], env, os.Stdin, os.Stdout, os.Stderr, "")
+	os.Exit(result.ExitCode)
+	return nil
+}
+
+// command prepares a command that starts the helper in new namespaces, where it
+// builds the sandbox and then executes the program at path
+func (s *SandboxService) command(path, command string, args []string) *exec.Cmd {
+	helperArgs := []string{SandboxInitArg}
+	for _, mount := range s.mounts {
+		helperArgs = append(helperArgs, "-ro", mount)
+	}
+	if dir, err := os.Getwd(); err == nil {
+		helperArgs = append(helperArgs, "-dir", dir)
+	}
+	helperArgs = append(helperArgs, "--", path, command)
+	helperArgs = append(helperArgs, args...)
+
+	cmd := exec.Command(s.helper, helperArgs...)
+	cmd.ExtraFiles = s.extraFiles
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags: syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS | syscall.CLONE_NEWPID | syscall.CLONE_NEWNET,
+		UidMappings: []syscall.SysProcIDMap{
+			{ContainerID: 0, HostID: os.Getuid(), Size: 1},
+		},
+		GidMappings: []syscall.SysProcIDMap{
+			{ContainerID: 0, HostID: os.Getgid(), Size: 1},
+		},
+	}
+	return cmd
+}
+
+// SandboxInit is the helper side of SandboxService. Called with the arguments that
+// follow SandboxInitArg in a process started in new namespaces, it builds the sandbox
+// and runs the command, then exits with its status. It never returns.
+//
+// The helper is process 1 of the new pid namespace, which the kernel protects from
+// every signal it has no handler for. Rather than becoming the command, which would
+// then ignore Ctrl-C and kill, it stays as the namespace's init: it forwards the
+// signals that end a command to it and reaps it, and any process it leaves behind.
+func SandboxInit(args []string) {
+	var mounts []string
+	dir := "/"
+	for len(args) > 1 && args[0] != "--" {
+		switch args[0] {
+		case "-ro":
+			mounts = append(mounts, args[1])
+		case "-dir":
+			dir = args[1]
+		default:
+			sandboxFail(fmt.Errorf("unknown option %s", args[0]))
+		}
+		args = args[2:]
+	}
+	if len(args) < 3 || args[0] != "--" {
+		sandboxFail(fmt.Errorf("usage: %s [-ro path]... [-dir dir] -- path argv0 [args...]", SandboxInitArg))
+	}
+	path, argv := args[1], args[2:]
+
+	if err := enterSandbox(mounts, dir); err != nil {
+		sandboxFail(err)
+	}
+
+	// Signals are caught before the command starts, since until then they would be lost
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, sandboxSignals...)
+
+	attr := &syscall.ProcAttr{Env: os.Environ(), Files: inheritedFds()}
+	pid, err := syscall.ForkExec(path, argv, attr)
+	if stderrors.Is(err, syscall.ENOEXEC) {
+		pid, err = syscall.ForkExec(DefaultScriptInterpreter, append([]string{DefaultScriptInterpreter, path}, argv[1:]...), attr)
+	}
+	if err != nil {
+		err = execError(argv[0], err)
+		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+		os.Exit(ExitStatus(err))
+	}
+
+	go func() {
+		for sig := range signals {
+			syscall.Kill(pid, sig.(syscall.Signal))
+		}
+	}()
+	os.Exit(reapSandboxed(pid))
+}
+
+// sandboxSignals are the signals the sandbox's init passes on to the command
+var sandboxSignals = []os.Signal{syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT}
+
+// reapSandboxed waits for the command with the given pid, reaping the orphans that
+// the sandbox's init inherits meanwhile, and returns the command's exit status. A
+// command killed by signal n gives 128+n, as init cannot be killed by the same signal.
+func reapSandboxed(pid int) int {
+	for {
+		var status syscall.WaitStatus
+		wpid, err := syscall.Wait4(-1, &status, 0, nil)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return 126
+		}
+		if wpid != pid {
+			continue
+		}
+		if status.Signaled() {
+			return 128 + int(status.Signal())
+		}
+		return status.ExitStatus()
+	}
+}
+
+// inheritedFds returns the descriptors the command inherits from the helper: those
+// without close-on-exec, which are the standard streams and the files the shell passes
+// above them. The rest are closed in the command.
+func inheritedFds() []uintptr {
+	entries, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		return []uintptr{0, 1, 2}
+	}
+	var fds []uintptr
+	for _, entry := range entries {
+		fd, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		flags, _, errno := syscall.Syscall(syscall.SYS_FCNTL, uintptr(fd), syscall.F_GETFD, 0)
+		if errno != 0 || flags&syscall.FD_CLOEXEC != 0 {
+			continue
+		}
+		for len(fds) <= fd {
+			// ForkExec closes the descriptors given as -1
+			fds = append(fds, ^uintptr(0))
+		}
+		fds[fd] = uintptr(fd)
+	}
+	return fds
+}
+
+// sandboxFail reports that the sandbox could not be built and exits with status 126,
+// as for a command that cannot be executed
+func sandboxFail(err error) {
+	fmt.Fprintf(os.Stderr, "sandbox: %v\n", err)
+	os.Exit(126)
+}
+
+// sandboxSource is a host path to bind-mount into the sandbox, opened before the
+// sandbox's root is mounted over anything that could hide it
+type sandboxSource struct {
+	path     string
+	fd       int
+	isDir    bool
+	readOnly bool
+}
+
+// enterSandbox replaces the root of the current mount namespace with a tmpfs holding
+// the given paths read-only, a few devices, a private /tmp and a /proc for the new
+// pid namespace, then changes to dir if it is visible there
+func enterSandbox(mounts []string, dir string) error {
+	// Keep the mounts below from propagating back to the host
+	if err := syscall.Mount("", "/", "", syscall.MS_REC|syscall.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("making mounts private: %w", err)
+	}
+
+	paths := mounts
+	if dir != "/" {
+		paths = append(paths, dir)
+	}
+	var sources []sandboxSource
+	for i, path := range append(paths, sandboxDevices...) {
+		source, err := openSandboxSource(path)
+		if err != nil {
+			// Default mounts such as /lib32 do not exist everywhere
+			continue
+		}
+		source.readOnly = i < len(paths)
+		sources = append(sources, source)
+	}
+
+	if err := syscall.Mount("tmpfs", sandboxRoot, "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV, "mode=0755"); err != nil {
+		return fmt.Errorf("mounting root: %w", err)
+	}
+	tmp := filepath.Join(sandboxRoot, "tmp")
+	if err := os.MkdirAll(tmp, 0o755); err != nil {
+		return err
+	}
+	if err := syscall.Mount("tmpfs", tmp, "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV, "mode=1777"); err != nil {
+		return fmt.Errorf("mounting /tmp: %w", err)
+	}
+
+	for _, source := range sources {
+		if err := bindSandboxSource(source); err != nil {
+			return fmt.Errorf("mounting %s: %w", source.path, err)
+		}
+	}
+
+	proc := filepath.Join(sandboxRoot, "proc")
+	if err := os.MkdirAll(proc, 0o555); err != nil {
+		return err
+	}
+	if err := syscall.Mount("proc", proc, "proc", syscall.MS_NOSUID|syscall.MS_NODEV|syscall.MS_NOEXEC, ""); err != nil {
+		return fmt.Errorf("mounting /proc: %w", err)
+	}
+
+	old := filepath.Join(sandboxRoot, ".old")
+	if err := os.MkdirAll(old, 0o700); err != nil {
+		return err
+	}
+	if err := syscall.PivotRoot(sandboxRoot, old); err != nil {
+		return fmt.Errorf("changing root: %w", err)
+	}
+	if err := syscall.Chdir("/"); err != nil {
+		return err
+	}
+	if err := syscall.Unmount("/.old", syscall.MNT_DETACH); err != nil {
+		return fmt.Errorf("detaching host root: %w", err)
+	}
+	if err := os.Remove("/.old"); err != nil {
+		return err
+	}
+	if err := syscall.Mount("tmpfs", "/", "tmpfs", syscall.MS_REMOUNT|syscall.MS_RDONLY|syscall.MS_NOSUID|syscall.MS_NODEV, ""); err != nil {
+		return fmt.Errorf("making root read-only: %w", err)
+	}
+
+	if syscall.Chdir(dir) != nil {
+		syscall.Chdir("/")
+	}
+	return nil
+}
+
+// openPath is Linux's O_PATH, which the syscall package does not define: it opens a
+// file only to refer to it, without needing permission to read it
+const openPath = 0x200000
+
+// openSandboxSource opens a host path so it can be bind-mounted through /proc/self/fd
+func openSandboxSource(path string) (sandboxSource, error) {
+	fd, err := syscall.Open(path, openPath|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return sandboxSource{}, err
+	}
+	var st syscall.Stat_t
+	if err := syscall.Fstat(fd, &st); err != nil {
+		syscall.Close(fd)
+		return sandboxSource{}, err
+	}
+	return sandboxSource{path: path, fd: fd, isDir: st.Mode&syscall.S_IFMT == syscall.S_IFDIR}, nil
+}
+
+// bindSandboxSource bind-mounts a source at the same path below the sandbox root
+func bindSandboxSource(source sandboxSource) error {
+	defer syscall.Close(source.fd)
+
+	target := filepath.Join(sandboxRoot, source.path)
+	if source.isDir {
+		if err := os.MkdirAll(target, 0o755); err != nil {
+			return err
+		}
+	} else {
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return err
+		}
+		file, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			return err
+		}
+		file.Close()
+	}
+
+	from := fmt.Sprintf("/proc/self/fd/%d", source.fd)
+	if err := syscall.Mount(from, target, "", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+		return err
+	}
+	if !source.readOnly {
+		return nil
+	}
+	return remountReadOnly(target)
+}
+
+// remountReadOnly makes the bind mount at target and the mounts below it, which the
+// recursive bind brought along, read-only. The kernel applies a bind remount to a
+// single mount even with MS_REC, so each mount listed in /proc/self/mountinfo at or
+// below target is remounted in turn.
+func remountReadOnly(target string) error {
+	points, err := mountPoints(target)
+	if err != nil {
+		return err
+	}
+	for _, point := range points {
+		// A remount must keep the flags the host mount is locked with, such as nosuid
+		var st syscall.Statfs_t
+		if err := syscall.Statfs(point, &st); err != nil {
+			return err
+		}
+		const lockedFlags = syscall.MS_NOSUID | syscall.MS_NODEV | syscall.MS_NOEXEC |
+			syscall.MS_NOATIME | syscall.MS_NODIRATIME | syscall.MS_RELATIME
+		flags := uintptr(syscall.MS_BIND|syscall.MS_REMOUNT|syscall.MS_RDONLY|syscall.MS_REC) | uintptr(st.Flags)&lockedFlags
+		if err := syscall.Mount("", point, "", flags, ""); err != nil {
+			return fmt.Errorf("%s: %w", point, err)
+		}
+	}
+	return nil
+}
+
+// mountPoints returns the mount points of the current mount namespace at or below
+// dir, parents first
+func mountPoints(dir string) ([]string, error) {
+	data, err := os.ReadFile("/proc/self/mountinfo")
+	if err != nil {
+		return nil, err
+	}
+	var points []string
+	for _, line := range strings.Split(string(data), "\n") {
+		// The fifth field is the mount point
+		fields := strings.Fields(line)
+		if len(fields) < 5 {
+			continue
+		}
+		point := unescapeMountInfo(fields[4])
+		if point == dir || strings.HasPrefix(point, dir+"/") {
+			points = append(points, point)
+		}
+	}
+	if len(points) == 0 {
+		points = []string{dir}
+	}
+	return points, nil
+}
+
+// unescapeMountInfo decodes the octal escapes, such as \040 for a space, that
+// /proc/self/mountinfo uses in paths
+func unescapeMountInfo(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+4 <= len(s) {
+			if n, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				sb.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		sb.WriteByte(s[i])
+	}
+	return sb.String()
+}
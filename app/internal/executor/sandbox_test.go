@@ -0,0 +1,97 @@
+package executor
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// TestMain lets the test binary prepare sandboxes, as the shell binary does
+func TestMain(m *testing.M) {
+	if len(os.Args) > 1 && os.Args[1] == SandboxInitArg {
+		SandboxInit(os.Args[2:])
+	}
+	os.Exit(m.Run())
+}
+
+func TestSandboxReadOnlySubmounts(t *testing.T) {
+	dir := t.TempDir()
+	sub := filepath.Join(dir, "sub")
+	if err := os.Mkdir(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	// Mounting below dir needs privileges the sandbox itself does not
+	if err := syscall.Mount("tmpfs", sub, "tmpfs", 0, ""); err != nil {
+		t.Skipf("cannot mount a tmpfs: %v", err)
+	}
+	defer syscall.Unmount(sub, syscall.MNT_DETACH)
+
+	sandbox, err := NewSandboxService(append([]string{dir}, DefaultSandboxMounts...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stderr bytes.Buffer
+	if result := sandbox.Execute("true", nil, nil, &stderr, &stderr); result.ExitCode != 0 {
+		t.Skipf("cannot create namespaces: %s", strings.TrimSpace(stderr.String()))
+	}
+
+	// Files cannot be created in a mounted directory, nor in the mounts below it
+	for _, path := range []string{filepath.Join(dir, "file"), filepath.Join(sub, "file")} {
+		stderr.Reset()
+		result := sandbox.Execute("touch", []string{path}, nil, &stderr, &stderr)
+		if result.ExitCode == 0 {
+			t.Errorf("Expected %s to be read-only in the sandbox", filepath.Dir(path))
+		}
+		if _, err := os.Stat(path); err == nil {
+			t.Errorf("Expected %s not to be created", path)
+		}
+	}
+}
+
+func TestSandboxSignal(t *testing.T) {
+	sandbox, err := NewSandboxService(DefaultSandboxMounts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stderr bytes.Buffer
+	if result := sandbox.Execute("true", nil, nil, &stderr, &stderr); result.ExitCode != 0 {
+		t.Skipf("cannot create namespaces: %s", strings.TrimSpace(stderr.String()))
+	}
+
+	// The command says when it runs, so that the signal is not sent while the
+	// sandbox is still being built
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	cmd, err := sandbox.Start("sh", []string{"-c", "echo ready; exec sleep 10"}, nil, nil, w, &stderr, -1)
+	w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Read(make([]byte, 16)); err != nil {
+		t.Fatal(err)
+	}
+
+	// The signal only reaches the sandbox's init, which passes it on
+	cmd.Process.Signal(syscall.SIGTERM)
+	done := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		cmd.Process.Kill()
+		t.Fatal("Expected the sandboxed command to die of SIGTERM")
+	}
+	if code := cmd.ProcessState.ExitCode(); code != 128+int(syscall.SIGTERM) {
+		t.Errorf("Expected exit status %d, but got %d (%q)", 128+int(syscall.SIGTERM), code, stderr.String())
+	}
+}
@@ -2,22 +2,130 @@ package executor
 
 import (
 	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+
+	"github.com/codecrafters-io/shell-starter-go/app/internal/errors"
 )
 
 // Service provides command execution functionality
-type Service struct{}
+type Service struct {
+	hash *HashTable
+	// interpreter runs executable files without a "#!" line
+	interpreter string
+	// ptys runs commands on pseudo-terminals, or is nil to use the given streams directly
+	ptys *pseudoTerminals
+	// extraFiles are the descriptors above 2 that commands inherit
+	extraFiles []*os.File
+}
 
 // NewService creates a new executor service
 func NewService() *Service {
-	return &Service{}
+	return &Service{
+		hash:        NewHashTable(),
+		interpreter: DefaultScriptInterpreter,
+	}
+}
+
+// SetScriptInterpreter sets the shell that runs executable files without a "#!" line
+func (s *Service) SetScriptInterpreter(path string) {
+	s.interpreter = path
+}
+
+// SetPseudoTerminal makes the executor run external commands with their standard input
+// and output on a new pseudo-terminal, whose output is copied to the given stdout. This
+// gives an embedding program, whose streams are buffers, the behaviour of a terminal.
+// Commands started as jobs keep using the streams directly.
+func (s *Service) SetPseudoTerminal(enabled bool) {
+	s.ptys = nil
+	if enabled {
+		s.ptys = newPseudoTerminals()
+	}
+}
+
+// SetWindowSize changes the size of the pseudo-terminals commands run on, including
+// those of running commands, which receive SIGWINCH
+func (s *Service) SetWindowSize(size WindowSize) {
+	if s.ptys != nil {
+		s.ptys.resize(size)
+	}
+}
+
+// SetExtraFiles sets the files commands inherit besides their standard streams: the
+// file at index i becomes descriptor 3+i, and a nil entry leaves that descriptor closed
+func (s *Service) SetExtraFiles(files []*os.File) {
+	s.extraFiles = files
 }
 
 // Execute executes an external command with the provided IO streams
-func (s *Service) Execute(command string, args []string, stdin io.Reader, stdout, stderr io.Writer) {
-	HandleExternalCommandWithIO(command, args, stdin, stdout, stderr)
+func (s *Service) Execute(command string, args []string, stdin io.Reader, stdout, stderr io.Writer) ExecResult {
+	return s.ExecuteWithEnv(command, args, nil, stdin, stdout, stderr)
+}
+
+// ExecuteWithEnv executes an external command with the given environment, as
+// a list of "name=value" entries; a nil env keeps the shell's own environment
+func (s *Service) ExecuteWithEnv(command string, args, env []string, stdin io.Reader, stdout, stderr io.Writer) ExecResult {
+	path, err := s.resolve(command)
+	if err != nil {
+		return reportError(stderr, err)
+	}
+	if s.ptys != nil {
+		return s.ptys.run(s.prepare(path, command, args), command, env, stdin, stdout, stderr, s.interpreter)
+	}
+	return runPrepared(s.prepare(path, command, args), command, env, stdin, stdout, stderr, s.interpreter)
+}
+
+// Start starts an external command with the given environment in its own process group
+// without waiting for it. A tty other than -1 makes the command the terminal's foreground
+// process group.
+func (s *Service) Start(command string, args, env []string, stdin io.Reader, stdout, stderr io.Writer, tty int) (*exec.Cmd, error) {
+	path, err := s.resolve(command)
+	if err != nil {
+		return nil, err
+	}
+	return startPrepared(s.prepare(path, command, args), command, env, stdin, stdout, stderr, tty, s.interpreter)
 }
 
-// FindCommand finds the full path of a command in the system PATH
+// prepare prepares a command that runs the program at path with the extra files
+func (s *Service) prepare(path, command string, args []string) *exec.Cmd {
+	cmd := newCommand(path, command, args)
+	cmd.ExtraFiles = s.extraFiles
+	return cmd
+}
+
+// Exec replaces the current process with the program at path. An executable file
+// without a "#!" line is run by the script interpreter, as for other commands.
+func (s *Service) Exec(path string, argv, env []string) error {
+	err := syscall.Exec(path, argv, env)
+	if err == syscall.ENOEXEC && s.interpreter != "" {
+		err = syscall.Exec(s.interpreter, append([]string{s.interpreter, path}, argv[1:]...), env)
+	}
+	return err
+}
+
+// resolve returns the path of the program to run for a command. Names containing
+// a slash are used directly; other names are looked up through the hash table.
+func (s *Service) resolve(command string) (string, error) {
+	if strings.Contains(command, "/") {
+		return ResolveCommand(command)
+	}
+	if path := s.hash.Lookup(command); path != "" {
+		return path, nil
+	}
+	return "", errors.NewCommandNotFoundError(command)
+}
+
+// FindCommand finds the full path of a command, preferring the path remembered in the hash table
 func (s *Service) FindCommand(commandName string) string {
-	return GetCommand(commandName)
+	if path, ok := s.hash.Get(commandName); ok {
+		return path
+	}
+	return s.hash.Search(commandName)
+}
+
+// CommandHash returns the table of remembered command paths
+func (s *Service) CommandHash() *HashTable {
+	return s.hash
 }
@@ -0,0 +1,152 @@
+package lineedit
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// maxListed is the number of completions listed without asking first
+const maxListed = 100
+
+// Completion is a candidate for the word being completed
+type Completion struct {
+	// Text replaces the word, quoted as the line needs it
+	Text string
+	// Display is shown when the candidates are listed, instead of Text if it is set
+	Display string
+	// NoSpace is set when no space should follow the word once it is complete, as
+	// after a directory whose contents may be completed next
+	NoSpace bool
+}
+
+// Completer returns the candidates for the word that ends at pos in line, and where
+// that word starts. The editor does not look into the candidates' order.
+type Completer func(line []rune, pos int) (start int, completions []Completion)
+
+// SetCompleter sets the function that completes words when Tab is pressed
+func (e *Editor) SetCompleter(c Completer) {
+	e.completer = c
+}
+
+// complete completes the word before the cursor. A single candidate replaces it;
+// several replace it with their common prefix, and a second Tab lists them.
+func (e *Editor) complete(last action) {
+	if e.completer == nil {
+		e.bell()
+		return
+	}
+	start, completions := e.completer(e.buf, e.pos)
+	e.last = actionComplete
+
+	switch len(completions) {
+	case 0:
+		e.bell()
+	case 1:
+		text := completions[0].Text
+		if !completions[0].NoSpace {
+			text += " "
+		}
+		e.replace(start, text)
+	default:
+		texts := make([]string, len(completions))
+		for i, c := range completions {
+			texts[i] = c.Text
+		}
+		prefix := commonPrefix(texts)
+		switch {
+		case prefix != string(e.buf[start:e.pos]) && len([]rune(prefix)) >= e.pos-start:
+			e.replace(start, prefix)
+		case last == actionComplete:
+			e.list(completions)
+		default:
+			e.bell()
+		}
+	}
+}
+
+// replace replaces the text from start to the cursor with text
+func (e *Editor) replace(start int, text string) {
+	e.saveUndo()
+	e.buf = append(e.buf[:start], e.buf[e.pos:]...)
+	e.pos = start
+	e.insert(text)
+}
+
+// list shows the candidates in columns below the line, sorted down each column as
+// ls does, and draws the line again after them
+func (e *Editor) list(completions []Completion) {
+	pos := e.pos
+	e.moveTo(len(e.buf))
+	io.WriteString(e.out, "\r\n")
+	defer func() {
+		e.cursorRow = 0
+		e.moveTo(pos)
+	}()
+
+	if len(completions) > maxListed {
+		fmt.Fprintf(e.out, "Display all %d possibilities? (y or n)", len(completions))
+		k, err := e.readKey()
+		io.WriteString(e.out, "\r\n")
+		if err != nil || k.r != 'y' && k.r != 'Y' && k.r != ' ' {
+			return
+		}
+	}
+
+	names := make([]string, len(completions))
+	colWidth := 0
+	for i, c := range completions {
+		names[i] = c.Display
+		if names[i] == "" {
+			names[i] = c.Text
+		}
+		colWidth = max(colWidth, stringWidth(names[i])+2)
+	}
+	cols := max(1, terminalWidth(e.fd)/colWidth)
+	rows := (len(names) + cols - 1) / cols
+
+	var sb strings.Builder
+	for row := 0; row < rows; row++ {
+		for col := 0; col < cols; col++ {
+			i := col*rows + row
+			if i >= len(names) {
+				break
+			}
+			sb.WriteString(names[i])
+			// The last column is not padded
+			if next := (col+1)*rows + row; next < len(names) {
+				sb.WriteString(strings.Repeat(" ", colWidth-stringWidth(names[i])))
+			}
+		}
+		sb.WriteString("\r\n")
+	}
+	io.WriteString(e.out, sb.String())
+}
+
+// bell rings the terminal's bell, when there is nothing to complete
+func (e *Editor) bell() {
+	io.WriteString(e.out, "\a")
+}
+
+// commonPrefix returns the longest prefix the texts share. A prefix that would end
+// in the middle of a backslash escape stops before the backslash.
+func commonPrefix(texts []string) string {
+	prefix := []rune(texts[0])
+	for _, text := range texts[1:] {
+		runes := []rune(text)
+		n := 0
+		for n < len(prefix) && n < len(runes) && prefix[n] == runes[n] {
+			n++
+		}
+		prefix = prefix[:n]
+	}
+
+	backslashes := 0
+	for i := len(prefix) - 1; i >= 0 && prefix[i] == '\\'; i-- {
+		backslashes++
+	}
+	if backslashes%2 == 1 {
+		prefix = prefix[:len(prefix)-1]
+	}
+	return string(prefix)
+}
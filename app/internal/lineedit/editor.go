@@ -0,0 +1,459 @@
+// Package lineedit reads lines from a terminal with Emacs-style editing: cursor
+// and word movement, a kill ring, undo, Tab completion, and a redraw that knows
+// how many columns each character takes.
+package lineedit
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ErrInterrupted is returned by ReadLine when the user presses Ctrl-C
+var ErrInterrupted = errors.New("interrupted")
+
+// maxKills is the number of killed texts the kill ring remembers
+const maxKills = 16
+
+// action classifies the last command, which decides whether consecutive kills
+// add to the same kill ring entry, which inserts undo together, whether
+// yank-pop may replace the text just yanked and whether Tab lists completions
+type action int
+
+const (
+	actionOther action = iota
+	actionInsert
+	actionKill
+	actionYank
+	actionComplete
+)
+
+// snapshot is the state of the line saved for undo
+type snapshot struct {
+	buf []rune
+	pos int
+}
+
+// key is a key press: a character, possibly with Alt, or an escape sequence
+type key struct {
+	r rune
+	// alt is set for a character sent after ESC, as terminals send Alt+character
+	alt bool
+	// seq is the escape sequence after ESC of a special key, such as "[D" for Left
+	seq string
+}
+
+// Editor reads lines from a terminal, letting the user edit them before pressing Enter
+type Editor struct {
+	in  io.Reader
+	out io.Writer
+	// fd is the terminal put in raw mode while reading and asked for its width, or -1
+	fd int
+
+	prompt string
+	buf    []rune
+	pos    int
+	// cursorRow is the row of the cursor below the first row of the prompt
+	cursorRow int
+
+	kills []string
+	// yankStart and yankEnd delimit the text just yanked, and yankIndex is the
+	// kill ring entry it came from
+	yankStart, yankEnd, yankIndex int
+	undo                          []snapshot
+	last                          action
+
+	// completer completes words on Tab, if set
+	completer Completer
+}
+
+// New creates an editor reading keys from the terminal in and drawing on out
+func New(in *os.File, out io.Writer) *Editor {
+	return newEditor(in, out, int(in.Fd()))
+}
+
+// newEditor creates an editor; with fd -1, in is not a terminal and is read as is
+func newEditor(in io.Reader, out io.Writer, fd int) *Editor {
+	return &Editor{in: in, out: out, fd: fd}
+}
+
+// ReadLine shows the prompt and returns the line the user enters. It returns
+// io.EOF when Ctrl-D is pressed on an empty line and ErrInterrupted for Ctrl-C.
+func (e *Editor) ReadLine(prompt string) (string, error) {
+	if e.fd >= 0 {
+		old, err := makeRaw(e.fd)
+		if err != nil {
+			return "", err
+		}
+		defer restoreMode(e.fd, old)
+	}
+
+	e.prompt = prompt
+	e.buf = nil
+	e.pos = 0
+	e.cursorRow = 0
+	e.undo = nil
+	e.last = actionOther
+	e.refresh()
+
+	for {
+		k, err := e.readKey()
+		if err != nil {
+			if err == io.EOF && len(e.buf) > 0 {
+				// Input that ends without a newline still completes the line
+				return e.accept(), nil
+			}
+			return "", err
+		}
+		if line, done, err := e.handle(k); done {
+			return line, err
+		}
+	}
+}
+
+// handle applies a key to the line. It returns done once the line is complete.
+func (e *Editor) handle(k key) (line string, done bool, err error) {
+	last := e.last
+	e.last = actionOther
+
+	switch {
+	case k.seq != "":
+		e.handleSequence(k.seq)
+	case k.alt:
+		e.handleAlt(k.r, last)
+	case k.r == '\r' || k.r == '\n':
+		return e.accept(), true, nil
+	case k.r == ctrl('C'):
+		e.moveTo(len(e.buf))
+		io.WriteString(e.out, "^C\r\n")
+		return "", true, ErrInterrupted
+	case k.r == ctrl('D'):
+		if len(e.buf) == 0 {
+			return "", true, io.EOF
+		}
+		e.deleteRange(e.pos, e.pos+1)
+	case k.r == ctrl('A'):
+		e.moveTo(0)
+	case k.r == ctrl('E'):
+		e.moveTo(len(e.buf))
+	case k.r == ctrl('B'):
+		e.moveTo(e.pos - 1)
+	case k.r == ctrl('F'):
+		e.moveTo(e.pos + 1)
+	case k.r == ctrl('H') || k.r == 0x7f:
+		e.deleteRange(e.pos-1, e.pos)
+	case k.r == ctrl('K'):
+		e.kill(e.pos, len(e.buf), last)
+	case k.r == ctrl('U'):
+		e.kill(0, e.pos, last)
+	case k.r == ctrl('W'):
+		e.kill(e.spaceWordStart(), e.pos, last)
+	case k.r == ctrl('Y'):
+		e.yank()
+	case k.r == ctrl('I'):
+		e.complete(last)
+	case k.r == ctrl('_'):
+		e.undoEdit()
+	case k.r == ctrl('L'):
+		io.WriteString(e.out, "\x1b[H\x1b[2J")
+		e.cursorRow = 0
+		e.refresh()
+	case !unicode.IsControl(k.r):
+		// Typing is undone a word at a time
+		if last != actionInsert || unicode.IsSpace(k.r) {
+			e.saveUndo()
+		}
+		e.insert(string(k.r))
+		e.last = actionInsert
+	}
+	return "", false, nil
+}
+
+// handleSequence applies a special key sent as an escape sequence
+func (e *Editor) handleSequence(seq string) {
+	switch seq {
+	case "[D", "OD":
+		e.moveTo(e.pos - 1)
+	case "[C", "OC":
+		e.moveTo(e.pos + 1)
+	case "[H", "OH", "[1~", "[7~":
+		e.moveTo(0)
+	case "[F", "OF", "[4~", "[8~":
+		e.moveTo(len(e.buf))
+	case "[3~":
+		e.deleteRange(e.pos, e.pos+1)
+	case "[1;5D", "[1;3D":
+		e.moveTo(e.wordStart())
+	case "[1;5C", "[1;3C":
+		e.moveTo(e.wordEnd())
+	}
+}
+
+// handleAlt applies a key pressed with Alt
+func (e *Editor) handleAlt(r rune, last action) {
+	switch r {
+	case 'b':
+		e.moveTo(e.wordStart())
+	case 'f':
+		e.moveTo(e.wordEnd())
+	case 'd':
+		e.kill(e.pos, e.wordEnd(), last)
+	case 0x7f, ctrl('H'):
+		e.kill(e.wordStart(), e.pos, last)
+	case 'y':
+		if last == actionYank {
+			e.yankPop()
+		}
+	}
+}
+
+// ctrl returns the character sent for Ctrl and the given key
+func ctrl(c rune) rune {
+	return c & 0x1f
+}
+
+// accept moves the cursor past the end of the line and returns it
+func (e *Editor) accept() string {
+	e.moveTo(len(e.buf))
+	io.WriteString(e.out, "\r\n")
+	return string(e.buf)
+}
+
+// moveTo moves the cursor to pos, kept within the line
+func (e *Editor) moveTo(pos int) {
+	e.pos = max(0, min(pos, len(e.buf)))
+	e.refresh()
+}
+
+// insert inserts text at the cursor and moves the cursor after it
+func (e *Editor) insert(text string) {
+	runes := []rune(text)
+	e.buf = append(e.buf[:e.pos], append(runes, e.buf[e.pos:]...)...)
+	e.pos += len(runes)
+	e.refresh()
+}
+
+// deleteRange deletes the characters from start to end, kept within the line
+func (e *Editor) deleteRange(start, end int) {
+	start, end = max(0, start), min(end, len(e.buf))
+	if start >= end {
+		return
+	}
+	e.saveUndo()
+	e.buf = append(e.buf[:start], e.buf[end:]...)
+	e.pos = start
+	e.refresh()
+}
+
+// kill deletes the characters from start to end into the kill ring. Consecutive
+// kills are collected in one entry, in the order the text appeared on the line.
+func (e *Editor) kill(start, end int, last action) {
+	if start >= end {
+		e.last = last
+		return
+	}
+	text := string(e.buf[start:end])
+	switch {
+	case last != actionKill || len(e.kills) == 0:
+		e.kills = append(e.kills, text)
+		if len(e.kills) > maxKills {
+			e.kills = e.kills[1:]
+		}
+	case start < e.pos:
+		e.kills[len(e.kills)-1] = text + e.kills[len(e.kills)-1]
+	default:
+		e.kills[len(e.kills)-1] += text
+	}
+	e.deleteRange(start, end)
+	e.last = actionKill
+}
+
+// yank inserts the most recently killed text at the cursor
+func (e *Editor) yank() {
+	if len(e.kills) == 0 {
+		return
+	}
+	e.saveUndo()
+	e.yankIndex = len(e.kills) - 1
+	e.yankStart = e.pos
+	e.insert(e.kills[e.yankIndex])
+	e.yankEnd = e.pos
+	e.last = actionYank
+}
+
+// yankPop replaces the text just yanked with the previous kill ring entry
+func (e *Editor) yankPop() {
+	e.yankIndex = (e.yankIndex + len(e.kills) - 1) % len(e.kills)
+	e.buf = append(e.buf[:e.yankStart], e.buf[e.yankEnd:]...)
+	e.pos = e.yankStart
+	e.insert(e.kills[e.yankIndex])
+	e.yankEnd = e.pos
+	e.last = actionYank
+}
+
+// saveUndo records the current line so that the next change can be undone
+func (e *Editor) saveUndo() {
+	e.undo = append(e.undo, snapshot{buf: append([]rune(nil), e.buf...), pos: e.pos})
+}
+
+// undoEdit restores the line as it was before the last change
+func (e *Editor) undoEdit() {
+	if len(e.undo) == 0 {
+		return
+	}
+	s := e.undo[len(e.undo)-1]
+	e.undo = e.undo[:len(e.undo)-1]
+	e.buf = s.buf
+	e.pos = s.pos
+	e.refresh()
+}
+
+// isWordRune reports whether r is part of a word for Alt-b, Alt-f and Alt-d
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// wordStart returns the start of the word before the cursor
+func (e *Editor) wordStart() int {
+	i := e.pos
+	for i > 0 && !isWordRune(e.buf[i-1]) {
+		i--
+	}
+	for i > 0 && isWordRune(e.buf[i-1]) {
+		i--
+	}
+	return i
+}
+
+// wordEnd returns the end of the word after the cursor
+func (e *Editor) wordEnd() int {
+	i := e.pos
+	for i < len(e.buf) && !isWordRune(e.buf[i]) {
+		i++
+	}
+	for i < len(e.buf) && isWordRune(e.buf[i]) {
+		i++
+	}
+	return i
+}
+
+// spaceWordStart returns the start of the whitespace-delimited word before the cursor, for Ctrl-W
+func (e *Editor) spaceWordStart() int {
+	i := e.pos
+	for i > 0 && unicode.IsSpace(e.buf[i-1]) {
+		i--
+	}
+	for i > 0 && !unicode.IsSpace(e.buf[i-1]) {
+		i--
+	}
+	return i
+}
+
+// readKey reads the next key press
+func (e *Editor) readKey() (key, error) {
+	r, err := e.readRune()
+	if err != nil || r != 0x1b {
+		return key{r: r}, err
+	}
+
+	next, err := e.readRune()
+	if err != nil {
+		return key{r: r}, nil
+	}
+	if next != '[' && next != 'O' {
+		return key{r: next, alt: true}, nil
+	}
+
+	// A control sequence ends with a byte from '@' to '~'; SS3 ('O') is always one more byte
+	seq := []rune{next}
+	for {
+		c, err := e.readRune()
+		if err != nil {
+			return key{}, err
+		}
+		seq = append(seq, c)
+		if next == 'O' || c >= 0x40 && c <= 0x7e {
+			return key{seq: string(seq)}, nil
+		}
+	}
+}
+
+// readRune reads one UTF-8 encoded character, a byte at a time so that nothing
+// typed after the line is taken from the commands that run next
+func (e *Editor) readRune() (rune, error) {
+	var b [utf8.UTFMax]byte
+	if _, err := io.ReadFull(e.in, b[:1]); err != nil {
+		return 0, err
+	}
+	n := 1
+	switch {
+	case b[0] >= 0xf0:
+		n = 4
+	case b[0] >= 0xe0:
+		n = 3
+	case b[0] >= 0xc0:
+		n = 2
+	}
+	if n > 1 {
+		if _, err := io.ReadFull(e.in, b[1:n]); err != nil {
+			return 0, err
+		}
+	}
+	r, _ := utf8.DecodeRune(b[:n])
+	return r, nil
+}
+
+// refresh redraws the prompt and the line and puts the cursor in place. Long lines
+// wrap, so the redraw starts from the row the prompt is on.
+func (e *Editor) refresh() {
+	width := terminalWidth(e.fd)
+	prompt := stripEscapes(e.prompt)
+
+	var sb strings.Builder
+	if e.cursorRow > 0 {
+		fmt.Fprintf(&sb, "\x1b[%dA", e.cursorRow)
+	}
+	sb.WriteString("\r\x1b[J")
+	sb.WriteString(e.prompt)
+	sb.WriteString(string(e.buf))
+
+	endRow, endCol := layout(append(append([]rune(nil), prompt...), e.buf...), width)
+	// A line that exactly fills its last row leaves the terminal's cursor on
+	// that row; move it to the start of the next one, as the layout does
+	if endCol == 0 && endRow > 0 {
+		sb.WriteString("\r\n")
+	}
+	row, col := layout(append(append([]rune(nil), prompt...), e.buf[:e.pos]...), width)
+	if endRow > row {
+		fmt.Fprintf(&sb, "\x1b[%dA", endRow-row)
+	}
+	sb.WriteByte('\r')
+	if col > 0 {
+		fmt.Fprintf(&sb, "\x1b[%dC", col)
+	}
+	e.cursorRow = row
+	io.WriteString(e.out, sb.String())
+}
+
+// layout returns the row and column after drawing text from the top-left corner of a
+// terminal width columns wide. A wide character that does not fit at the end of a row
+// goes to the next one.
+func layout(text []rune, width int) (row, col int) {
+	for _, r := range text {
+		w := runeWidth(r)
+		if col+w > width {
+			row++
+			col = 0
+		}
+		col += w
+		if col == width {
+			row++
+			col = 0
+		}
+	}
+	return row, col
+}
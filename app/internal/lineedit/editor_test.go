@@ -0,0 +1,151 @@
+package lineedit
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+// readLine feeds keys to an editor that is not on a terminal and returns the line it reads
+func readLine(t *testing.T, e *Editor, keys string) (string, error) {
+	t.Helper()
+	e.in = strings.NewReader(keys)
+	return e.ReadLine("$ ")
+}
+
+func TestEditorKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		keys     string
+		expected string
+	}{
+		{name: "plain line", keys: "echo hi\r", expected: "echo hi"},
+		{name: "arrows insert in the middle", keys: "echo wrld\x1b[D\x1b[D\x1b[Do\r", expected: "echo world"},
+		{name: "home and end", keys: "cho\x1b[He\x1b[F!\r", expected: "echo!"},
+		{name: "ctrl-a and ctrl-e", keys: "b\x01a\x05c\r", expected: "abc"},
+		{name: "backspace and delete", keys: "abcd\x7f\x01\x1b[3~\r", expected: "bc"},
+		{name: "word movement", keys: "one two three\x1bb\x1bbX\x1bf\x1bfY\r", expected: "one Xtwo threeY"},
+		{name: "ctrl-left and ctrl-right", keys: "one two\x1b[1;5DX\x1b[1;5CY\r", expected: "one XtwoY"},
+		{name: "ctrl-k and yank", keys: "hello world\x1bb\x0b\x01\x19 \r", expected: "world hello "},
+		{name: "ctrl-u", keys: "abc def\x1b[D\x1b[D\x15\r", expected: "ef"},
+		{name: "consecutive ctrl-w kills yank together", keys: "echo one two\x17\x17\x19\x19\r", expected: "echo one twoone two"},
+		{name: "alt-d and alt-backspace", keys: "a bb cc\x1bb\x1bb\x1bd\x1b\x7f\r", expected: " cc"},
+		{name: "yank-pop cycles the kill ring", keys: "aa\x15bb\x15\x19\x1by\r", expected: "aa"},
+		{name: "undo typing a word at a time", keys: "echo abc\x1f\r", expected: "echo"},
+		{name: "undo kill", keys: "echo abc\x15\x1f\r", expected: "echo abc"},
+		{name: "ctrl-d deletes under the cursor", keys: "ab\x01\x04\r", expected: "b"},
+		{name: "unicode", keys: "日本\x02x\r", expected: "日x本"},
+		{name: "end of input completes the line", keys: "ls", expected: "ls"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newEditor(nil, io.Discard, -1)
+			line, err := readLine(t, e, tt.keys)
+			if err != nil {
+				t.Fatalf("ReadLine() error: %v", err)
+			}
+			if line != tt.expected {
+				t.Errorf("ReadLine() = %q, want %q", line, tt.expected)
+			}
+		})
+	}
+}
+
+func TestEditorEndings(t *testing.T) {
+	var out bytes.Buffer
+	e := newEditor(nil, &out, -1)
+	if _, err := readLine(t, e, "\x04"); err != io.EOF {
+		t.Errorf("Expected io.EOF for Ctrl-D on an empty line, but got %v", err)
+	}
+	if _, err := readLine(t, e, "abc\x03"); err != ErrInterrupted {
+		t.Errorf("Expected ErrInterrupted for Ctrl-C, but got %v", err)
+	}
+	if !strings.HasSuffix(out.String(), "\x1b[5C^C\r\n") {
+		t.Errorf("Expected ^C after the line, but got %q", out.String())
+	}
+
+	// The kill ring survives from one line to the next
+	readLine(t, e, "first\x15\r")
+	if line, _ := readLine(t, e, "\x19\r"); line != "first" {
+		t.Errorf("Expected the kill ring to persist, but got %q", line)
+	}
+}
+
+func TestLayout(t *testing.T) {
+	tests := []struct {
+		text     string
+		width    int
+		row, col int
+	}{
+		{text: "abc", width: 10, row: 0, col: 3},
+		{text: "abcde", width: 5, row: 1, col: 0},
+		{text: "abcdef", width: 5, row: 1, col: 1},
+		// A wide character that does not fit moves to the next row
+		{text: "abcd日", width: 5, row: 1, col: 2},
+		{text: "é", width: 10, row: 0, col: 1},
+	}
+	for _, tt := range tests {
+		row, col := layout([]rune(tt.text), tt.width)
+		if row != tt.row || col != tt.col {
+			t.Errorf("layout(%q, %d) = %d, %d, want %d, %d", tt.text, tt.width, row, col, tt.row, tt.col)
+		}
+	}
+
+	if w := stringWidth("\x1b[1;32m$\x1b[0m 日本"); w != 6 {
+		t.Errorf("stringWidth() = %d, want 6", w)
+	}
+}
+
+func TestEditorComplete(t *testing.T) {
+	completer := func(line []rune, pos int) (int, []Completion) {
+		start := pos
+		for start > 0 && line[start-1] != ' ' {
+			start--
+		}
+		var completions []Completion
+		for _, c := range []Completion{{Text: "echo"}, {Text: "exit"}, {Text: "export"}, {Text: "src/", NoSpace: true}} {
+			if strings.HasPrefix(c.Text, string(line[start:pos])) {
+				completions = append(completions, c)
+			}
+		}
+		return start, completions
+	}
+
+	tests := []struct {
+		name     string
+		keys     string
+		expected string
+	}{
+		{name: "single match adds a space", keys: "ec\tx\r", expected: "echo x"},
+		{name: "no space after a directory", keys: "ls s\tmain\r", expected: "ls src/main"},
+		{name: "common prefix", keys: "exp\t\r", expected: "export "},
+		{name: "ambiguous prefix", keys: "ex\t\r", expected: "ex"},
+		{name: "no match", keys: "zz\t\r", expected: "zz"},
+		{name: "completion in the middle of the line", keys: "ec x\x01\x06\x06\t\r", expected: "echo  x"},
+		{name: "undo completion", keys: "ec\t\x1f\r", expected: "ec"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newEditor(nil, io.Discard, -1)
+			e.SetCompleter(completer)
+			line, err := readLine(t, e, tt.keys)
+			if err != nil {
+				t.Fatalf("ReadLine() error: %v", err)
+			}
+			if line != tt.expected {
+				t.Errorf("ReadLine() = %q, want %q", line, tt.expected)
+			}
+		})
+	}
+
+	// A second Tab lists the candidates in columns
+	var out bytes.Buffer
+	e := newEditor(nil, &out, -1)
+	e.SetCompleter(completer)
+	readLine(t, e, "e\t\t\r")
+	if !strings.Contains(out.String(), "\r\necho    exit    export\r\n") {
+		t.Errorf("Expected the candidates listed, but got %q", out.String())
+	}
+}
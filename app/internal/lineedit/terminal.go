@@ -0,0 +1,63 @@
+package lineedit
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// defaultWidth is the width assumed when the terminal cannot report its own
+const defaultWidth = 80
+
+// Supported reports whether lines can be edited on f: it must be a terminal
+// that understands cursor movement, which a dumb terminal does not
+func Supported(f *os.File) bool {
+	if os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	var t syscall.Termios
+	return ioctl(int(f.Fd()), syscall.TCGETS, unsafe.Pointer(&t)) == nil
+}
+
+// makeRaw puts the terminal in raw mode, where each key is read as soon as it is
+// pressed and neither echoed nor turned into a signal, and returns the previous
+// settings. Output processing is kept, so a newline still starts a new line.
+func makeRaw(fd int) (*syscall.Termios, error) {
+	var old syscall.Termios
+	if err := ioctl(fd, syscall.TCGETS, unsafe.Pointer(&old)); err != nil {
+		return nil, err
+	}
+	raw := old
+	raw.Iflag &^= syscall.BRKINT | syscall.ICRNL | syscall.INPCK | syscall.ISTRIP | syscall.IXON
+	raw.Cflag |= syscall.CS8
+	raw.Lflag &^= syscall.ECHO | syscall.ICANON | syscall.IEXTEN | syscall.ISIG
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+	if err := ioctl(fd, syscall.TCSETS, unsafe.Pointer(&raw)); err != nil {
+		return nil, err
+	}
+	return &old, nil
+}
+
+// restoreMode puts back terminal settings saved by makeRaw
+func restoreMode(fd int, old *syscall.Termios) error {
+	return ioctl(fd, syscall.TCSETS, unsafe.Pointer(old))
+}
+
+// terminalWidth returns the number of columns of the terminal fd
+func terminalWidth(fd int) int {
+	var ws struct{ rows, cols, xpixel, ypixel uint16 }
+	if fd < 0 || ioctl(fd, syscall.TIOCGWINSZ, unsafe.Pointer(&ws)) != nil || ws.cols == 0 {
+		return defaultWidth
+	}
+	return int(ws.cols)
+}
+
+// ioctl performs a terminal ioctl whose argument is a pointer
+func ioctl(fd int, request uintptr, arg unsafe.Pointer) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), request, uintptr(arg))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
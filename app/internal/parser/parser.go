@@ -12,12 +12,16 @@ import (
 // StderrRedirection indicates standard error redirection ('2>').
 // StdoutAppendRedirection indicates standard output append redirection ('>>').
 // StderrAppendRedirection indicates standard error append redirection ('2>>').
+// StdoutClobberRedirection indicates standard output redirection that ignores noclobber ('>|' or '1>|').
+// StderrClobberRedirection indicates standard error redirection that ignores noclobber ('2>|').
 const (
 	NoRedirection = iota
 	StdoutRedirection
 	StderrRedirection
 	StdoutAppendRedirection
 	StderrAppendRedirection
+	StdoutClobberRedirection
+	StderrClobberRedirection
 )
 
 // RedirectionInfo holds information about redirection found in a command
@@ -92,10 +96,20 @@ func tryParseNumberedRedirection(runes []rune, i int, expectedDigit rune, redire
 
 // tryParseNumberedAppendRedirection attempts to parse '1>>' or '2>>' redirection
 func tryParseNumberedAppendRedirection(runes []rune, i int, expectedDigit rune, redirectType int) (commandPart string, redirect RedirectionInfo, found bool) {
+	return tryParseNumberedTwoCharRedirection(runes, i, expectedDigit, '>', redirectType)
+}
+
+// tryParseNumberedClobberRedirection attempts to parse '1>|' or '2>|' redirection
+func tryParseNumberedClobberRedirection(runes []rune, i int, expectedDigit rune, redirectType int) (commandPart string, redirect RedirectionInfo, found bool) {
+	return tryParseNumberedTwoCharRedirection(runes, i, expectedDigit, '|', redirectType)
+}
+
+// tryParseNumberedTwoCharRedirection attempts to parse a digit followed by '>' and second
+func tryParseNumberedTwoCharRedirection(runes []rune, i int, expectedDigit, second rune, redirectType int) (commandPart string, redirect RedirectionInfo, found bool) {
 	n := len(runes)
 
-	// Check for pattern: digit + '>>'
-	if i+2 < n && runes[i] == expectedDigit && runes[i+1] == '>' && runes[i+2] == '>' {
+	// Check for pattern: digit + '>' + second
+	if i+2 < n && runes[i] == expectedDigit && runes[i+1] == '>' && runes[i+2] == second {
 		if isStandaloneDigit(runes, i) {
 			commandPart = strings.TrimSpace(string(runes[:i]))
 			filename := strings.TrimSpace(string(runes[i+3:]))
@@ -138,10 +152,20 @@ func parseGenericRedirection(runes []rune, i int) (commandPart string, redirect
 
 // parseGenericAppendRedirection handles generic '>>' redirection with optional file descriptor
 func parseGenericAppendRedirection(runes []rune, i int) (commandPart string, redirect RedirectionInfo) {
+	return parseGenericTwoCharRedirection(runes, i, '>', StdoutAppendRedirection, StderrAppendRedirection)
+}
+
+// parseGenericClobberRedirection handles generic '>|' redirection with optional file descriptor
+func parseGenericClobberRedirection(runes []rune, i int) (commandPart string, redirect RedirectionInfo) {
+	return parseGenericTwoCharRedirection(runes, i, '|', StdoutClobberRedirection, StderrClobberRedirection)
+}
+
+// parseGenericTwoCharRedirection handles a generic '>' followed by second, with optional file descriptor
+func parseGenericTwoCharRedirection(runes []rune, i int, second rune, stdoutType, stderrType int) (commandPart string, redirect RedirectionInfo) {
 	n := len(runes)
 
-	// Make sure we have '>>' pattern
-	if i+1 >= n || runes[i+1] != '>' {
+	// Make sure we have '>' + second pattern
+	if i+1 >= n || runes[i+1] != second {
 		return "", RedirectionInfo{}
 	}
 
@@ -156,14 +180,14 @@ func parseGenericAppendRedirection(runes []rune, i int) (commandPart string, red
 		j--
 	}
 
-	redirectType := StdoutAppendRedirection
+	redirectType := stdoutType
 	commandEndIndex := j + 1
 
 	// Check for explicit file descriptor (1 or 2)
 	if j >= 0 && (runes[j] == '1' || runes[j] == '2') {
 		if isStandaloneDigit(runes, j) {
 			if runes[j] == '2' {
-				redirectType = StderrAppendRedirection
+				redirectType = stderrType
 			}
 			commandEndIndex = j
 		}
@@ -199,6 +223,14 @@ func findRedirection(line string) (commandPart string, redirect RedirectionInfo)
 				return cmdPart, redir
 			}
 
+			// Try parsing '2>|' and '1>|' redirection
+			if cmdPart, redir, found := tryParseNumberedClobberRedirection(runes, i, '2', StderrClobberRedirection); found {
+				return cmdPart, redir
+			}
+			if cmdPart, redir, found := tryParseNumberedClobberRedirection(runes, i, '1', StdoutClobberRedirection); found {
+				return cmdPart, redir
+			}
+
 			// Try parsing '2>' redirection
 			if cmdPart, redir, found := tryParseNumberedRedirection(runes, i, '2', StderrRedirection); found {
 				return cmdPart, redir
@@ -224,6 +256,14 @@ func findRedirection(line string) (commandPart string, redirect RedirectionInfo)
 					continue
 				}
 
+				// '>|' is '>' that overwrites files even with noclobber set
+				if i+1 < n && runes[i+1] == '|' {
+					if cmdPart, redir := parseGenericClobberRedirection(runes, i); redir.Found {
+						return cmdPart, redir
+					}
+					continue
+				}
+
 				// Single '>' redirection (only if not part of '>>')
 				if cmdPart, redir := parseGenericRedirection(runes, i); redir.Found {
 					return cmdPart, redir
@@ -328,9 +368,17 @@ func ParseLine(line string) (args []string, outputFile string, errorFile string,
 // Text within quotes is treated as a single argument, and the quotes are removed.
 // Returns append mode flags for both stdout and stderr redirection.
 func ParseLineWithMode(line string) (args []string, outputFile string, errorFile string, outputAppend bool, errorAppend bool, err error) {
+	args, outputFile, errorFile, outputAppend, errorAppend, _, err = ParseLineWithClobber(line)
+	return args, outputFile, errorFile, outputAppend, errorAppend, err
+}
+
+// ParseLineWithClobber splits a line like ParseLineWithMode, and also handles the '>|',
+// '1>|' and '2>|' operators, which overwrite a file even when noclobber is set.
+// clobber reports whether the line's redirection is one of them.
+func ParseLineWithClobber(line string) (args []string, outputFile string, errorFile string, outputAppend bool, errorAppend bool, clobber bool, err error) {
 	// Handle empty input
 	if strings.TrimSpace(line) == "" {
-		return []string{}, "", "", false, false, nil
+		return []string{}, "", "", false, false, false, nil
 	}
 
 	// Find and extract redirection
@@ -338,7 +386,7 @@ func ParseLineWithMode(line string) (args []string, outputFile string, errorFile
 
 	// Validate redirection
 	if err := validateRedirection(redirect); err != nil {
-		return nil, "", "", false, false, err
+		return nil, "", "", false, false, false, err
 	}
 
 	// Set output files and append modes based on redirection type
@@ -356,14 +404,20 @@ func ParseLineWithMode(line string) (args []string, outputFile string, errorFile
 		case StderrAppendRedirection:
 			errorFile = redirect.Filename
 			errorAppend = true
+		case StdoutClobberRedirection:
+			outputFile = redirect.Filename
+			clobber = true
+		case StderrClobberRedirection:
+			errorFile = redirect.Filename
+			clobber = true
 		}
 	}
 
 	// Tokenize the command part
 	args, err = tokenize(commandPart)
 	if err != nil {
-		return nil, "", "", false, false, err
+		return nil, "", "", false, false, false, err
 	}
 
-	return args, outputFile, errorFile, outputAppend, errorAppend, nil
+	return args, outputFile, errorFile, outputAppend, errorAppend, clobber, nil
 }
@@ -640,3 +640,73 @@ func TestParseLineAppendRedirection(t *testing.T) {
 	}
 }
 
+func TestParseLineClobberRedirection(t *testing.T) {
+	tests := []struct {
+		name           string
+		input          string
+		expectedArgs   []string
+		expectedOutput string
+		expectedError  string
+		clobber        bool
+	}{
+		{
+			name:           "clobber redirection >|",
+			input:          "echo hello >| out.txt",
+			expectedArgs:   []string{"echo", "hello"},
+			expectedOutput: "out.txt",
+			clobber:        true,
+		},
+		{
+			name:           "clobber redirection 1>|",
+			input:          "echo hello 1>| out.txt",
+			expectedArgs:   []string{"echo", "hello"},
+			expectedOutput: "out.txt",
+			clobber:        true,
+		},
+		{
+			name:          "error clobber redirection 2>|",
+			input:         "ls /nonexistent 2>| err.txt",
+			expectedArgs:  []string{"ls", "/nonexistent"},
+			expectedError: "err.txt",
+			clobber:       true,
+		},
+		{
+			name:           "plain redirection does not clobber",
+			input:          "echo hello > out.txt",
+			expectedArgs:   []string{"echo", "hello"},
+			expectedOutput: "out.txt",
+		},
+		{
+			name:         "clobber operator inside quotes should not redirect",
+			input:        "echo 'hello >| world'",
+			expectedArgs: []string{"echo", "hello >| world"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, outputFile, errorFile, outputAppend, errorAppend, clobber, err := ParseLineWithClobber(tt.input)
+
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+				return
+			}
+
+			if !reflect.DeepEqual(args, tt.expectedArgs) {
+				t.Errorf("args = %v, want %v", args, tt.expectedArgs)
+			}
+			if outputFile != tt.expectedOutput {
+				t.Errorf("outputFile = %q, want %q", outputFile, tt.expectedOutput)
+			}
+			if errorFile != tt.expectedError {
+				t.Errorf("errorFile = %q, want %q", errorFile, tt.expectedError)
+			}
+			if outputAppend || errorAppend {
+				t.Errorf("append = %v, %v, want false", outputAppend, errorAppend)
+			}
+			if clobber != tt.clobber {
+				t.Errorf("clobber = %v, want %v", clobber, tt.clobber)
+			}
+		})
+	}
+}
@@ -1,5 +1,9 @@
 package parser
 
+import (
+	"github.com/codecrafters-io/shell-starter-go/app/syntax"
+)
+
 // Service provides command parsing functionality
 type Service struct{}
 
@@ -17,3 +21,13 @@ func (s *Service) ParseLine(line string) (args []string, outputFile string, erro
 func (s *Service) ParseLineWithMode(line string) (args []string, outputFile string, errorFile string, outputAppend bool, errorAppend bool, err error) {
 	return ParseLineWithMode(line)
 }
+
+// ParseLineWithClobber parses a command line like ParseLineWithMode and reports whether its redirection is '>|'
+func (s *Service) ParseLineWithClobber(line string) (args []string, outputFile string, errorFile string, outputAppend bool, errorAppend bool, clobber bool, err error) {
+	return ParseLineWithClobber(line)
+}
+
+// Parse parses a complete script into a syntax tree using the public syntax package
+func (s *Service) Parse(src, name string) (*syntax.File, error) {
+	return syntax.Parse(src, name)
+}
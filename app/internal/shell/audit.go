@@ -0,0 +1,225 @@
+package shell
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/codecrafters-io/shell-starter-go/app/syntax"
+)
+
+// AuditEntry is one command recorded in the audit log
+type AuditEntry struct {
+	Time time.Time `json:"time"`
+	User string    `json:"user"`
+	Cwd  string    `json:"cwd"`
+	// Line is the source text of the statement the command came from
+	Line string   `json:"line"`
+	Argv []string `json:"argv"`
+	// Path is the program that was run, or empty for builtins and commands that were not found
+	Path         string   `json:"path,omitempty"`
+	Builtin      bool     `json:"builtin,omitempty"`
+	Status       int      `json:"status"`
+	DurationMs   float64  `json:"duration_ms"`
+	Redirections []string `json:"redirections,omitempty"`
+	Background   bool     `json:"background,omitempty"`
+	// Exec is set for a command that replaced the shell with exec. The entry is written
+	// before the program starts, so its status is not known; if exec fails, the exec
+	// statement is recorded again with its status.
+	Exec bool `json:"exec,omitempty"`
+	// DryRun is set for a command the dryrun option described instead of running,
+	// so no program was run
+	DryRun bool `json:"dry_run,omitempty"`
+}
+
+// AuditLog appends a JSON object per executed command to a file. Each entry is
+// written with a single write to a file opened with O_APPEND, so that several
+// shells can share a log without interleaving entries.
+type AuditLog struct {
+	mu   sync.Mutex
+	file *os.File
+	user string
+	// redact matches the text of the statements that are left out of the log
+	redact *regexp.Regexp
+}
+
+// OpenAuditLog opens or creates the audit log at path. Commands from statements
+// whose text matches redact, if it is not nil, are not recorded.
+func OpenAuditLog(path string, redact *regexp.Regexp) (*AuditLog, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("audit: %w", err)
+	}
+
+	name := os.Getenv("USER")
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	return &AuditLog{file: file, user: name, redact: redact}, nil
+}
+
+// Record appends an entry to the log, unless its line is redacted
+func (l *AuditLog) Record(entry AuditEntry) error {
+	if l.redact != nil && l.redact.MatchString(entry.Line) {
+		return nil
+	}
+	entry.User = l.user
+	// Keep redirection operators readable instead of escaping them for HTML
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(entry); err != nil {
+		return fmt.Errorf("audit: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.file.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("audit: %w", err)
+	}
+	return nil
+}
+
+// Sync flushes the log to stable storage
+func (l *AuditLog) Sync() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Sync()
+}
+
+// Close flushes the log to stable storage and closes it
+func (l *AuditLog) Close() error {
+	if err := l.Sync(); err != nil {
+		l.file.Close()
+		return err
+	}
+	return l.file.Close()
+}
+
+// SetAuditLog makes the shell record every command it executes in log
+func (s *Shell) SetAuditLog(log *AuditLog) {
+	s.audit = log
+}
+
+// auditRecord is a command being executed, recorded in the audit log once it finishes
+type auditRecord struct {
+	cwd        string
+	line       string
+	args       []string
+	redirs     []Redirection
+	background bool
+	start      time.Time
+	// recorded is set once the entry has been written, which exec does early
+	recorded bool
+	// dryRun is set when the command was only described
+	dryRun bool
+}
+
+// startAudit begins the audit record of a command that is about to run, from the
+// statement being executed
+func (s *Shell) startAudit(args []string, redirs []Redirection, background bool) *auditRecord {
+	cwd, _ := os.Getwd()
+	return &auditRecord{
+		cwd:        cwd,
+		line:       s.auditLine,
+		args:       args,
+		redirs:     redirs,
+		background: background,
+		start:      time.Now(),
+	}
+}
+
+// auditCommand records a command that has finished, or started in the background.
+// A command is recorded once, and nothing is recorded once exit has closed the log.
+func (s *Shell) auditCommand(record *auditRecord, status int) {
+	if s.audit == nil || record.recorded {
+		return
+	}
+	entry := record.entry(record.args)
+	entry.Status = status
+	entry.DurationMs = float64(time.Since(record.start).Microseconds()) / 1000
+	switch {
+	case record.dryRun:
+		entry.DryRun = true
+	case s.builtins.IsBuiltin(record.args[0]):
+		entry.Builtin = true
+	default:
+		entry.Path = s.executor.FindCommand(record.args[0])
+	}
+	s.writeAudit(record, entry)
+}
+
+// auditExec records the program exec is about to replace the shell with, since the
+// statement's own record is never written once it has, and flushes the log
+func (s *Shell) auditExec(path string, argv []string) {
+	record := s.auditing
+	if s.audit == nil || record == nil || record.recorded {
+		return
+	}
+	entry := record.entry(argv)
+	entry.Path = path
+	entry.Exec = true
+	s.writeAudit(record, entry)
+	s.audit.Sync()
+}
+
+// entry returns the log entry for the record with the given arguments
+func (r *auditRecord) entry(argv []string) AuditEntry {
+	entry := AuditEntry{
+		Time:       r.start,
+		Cwd:        r.cwd,
+		Line:       r.line,
+		Argv:       argv,
+		Background: r.background,
+	}
+	for _, redir := range r.redirs {
+		entry.Redirections = append(entry.Redirections, describeRedirection(redir))
+	}
+	return entry
+}
+
+// writeAudit writes the entry of a record to the log
+func (s *Shell) writeAudit(record *auditRecord, entry AuditEntry) {
+	record.recorded = true
+	if err := s.audit.Record(entry); err != nil {
+		fmt.Fprintf(s.stderr, "%s\n", err.Error())
+	}
+}
+
+// statementText returns the source text of a statement in src without a ';' ending
+// it, which is what the audit log records and redacts
+func statementText(src string, stmt *syntax.Stmt) string {
+	start, end := sourceOffset(src, stmt.Pos()), sourceOffset(src, stmt.End)
+	if end < start {
+		return ""
+	}
+	text := strings.TrimSpace(src[start:end])
+	if strings.HasSuffix(text, ";") && !strings.HasSuffix(text, "\\;") {
+		text = strings.TrimSpace(strings.TrimSuffix(text, ";"))
+	}
+	return text
+}
+
+// sourceOffset returns the byte offset in src of a position, whose column counts runes
+func sourceOffset(src string, pos syntax.Pos) int {
+	offset := 0
+	for line := 1; line < pos.Line; line++ {
+		i := strings.IndexByte(src[offset:], '\n')
+		if i < 0 {
+			return len(src)
+		}
+		offset += i + 1
+	}
+	for col := 1; col < pos.Col && offset < len(src); col++ {
+		_, size := utf8.DecodeRuneInString(src[offset:])
+		offset += size
+	}
+	return offset
+}
@@ -0,0 +1,356 @@
+package shell
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/codecrafters-io/shell-starter-go/app/internal/lineedit"
+)
+
+// passwdFile lists the users whose names complete after ~
+const passwdFile = "/etc/passwd"
+
+// specialChars are the characters a backslash quotes in a completed word. A
+// leading ~ is left alone: it is what makes ~/ and ~user/ paths work.
+const specialChars = " \t\n\\'\"`$&|;()<>*?[]#!{}"
+
+// variableSuffix matches a parameter expansion being typed at the end of a word
+var variableSuffix = regexp.MustCompile(`\$(\{?)([A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// completionWord is the word before the cursor, as far as it was typed
+type completionWord struct {
+	// start is the position of the word in the line, and raw its text as typed
+	start int
+	raw   string
+	// value is the word with its quotes removed
+	value string
+	// quote is the quote left open in the word, if any
+	quote rune
+	// command is set when the word is a command name, and redirect when it names a
+	// redirection's file
+	command  bool
+	redirect bool
+	// name is the command the word is an argument of, if any
+	name string
+	// words are the command's words from its name up to the word being completed, as
+	// typed and without redirections, and cword is the index of that word among them
+	words []string
+	cword int
+}
+
+// completeLine completes the word before the cursor for the line editor: an
+// argument as the complete builtin defined for its command, a variable after $,
+// a user after ~, a command name in command position and a path anywhere else
+func (s *Shell) completeLine(line []rune, pos int) (int, []lineedit.Completion) {
+	word := splitCompletionWord(line[:pos])
+	if spec := s.compSpecs[word.name]; spec != nil && !word.command && !word.redirect {
+		return word.start, s.programmableCompletions(spec, word, line[:pos])
+	}
+
+	if word.quote != '\'' {
+		if m := variableSuffix.FindStringSubmatchIndex(word.raw); m != nil {
+			start := word.start + utf8.RuneCountInString(word.raw[:m[0]])
+			brace := word.raw[m[2]:m[3]]
+			var completions []lineedit.Completion
+			for _, name := range s.variableNames(word.raw[m[0]+1+len(brace):]) {
+				if brace != "" {
+					name = "{" + name + "}"
+				}
+				completions = append(completions, lineedit.Completion{Text: "$" + name})
+			}
+			return start, completions
+		}
+	}
+
+	if word.quote == 0 && strings.HasPrefix(word.value, "~") && !strings.Contains(word.value, "/") {
+		var completions []lineedit.Completion
+		for _, name := range userNames(word.value[1:]) {
+			completions = append(completions, lineedit.Completion{Text: "~" + name + "/", Display: "~" + name, NoSpace: true})
+		}
+		return word.start, completions
+	}
+
+	if word.command && !strings.Contains(word.value, "/") {
+		names := s.commandNames(word.value)
+		var completions []lineedit.Completion
+		for _, name := range names {
+			completions = append(completions, lineedit.Completion{Text: quoteCompletion(name, word.quote, len(names) == 1)})
+		}
+		return word.start, completions
+	}
+
+	paths := s.pathNames(word.value, false)
+	var completions []lineedit.Completion
+	for _, path := range paths {
+		info, err := os.Stat(s.expandHome(path))
+		if err != nil {
+			continue
+		}
+		// A path in command position must be something that can be run
+		if word.command && !info.IsDir() && info.Mode()&0111 == 0 {
+			continue
+		}
+		completions = append(completions, s.fileCompletion(path, word.quote, len(paths) == 1))
+	}
+	return word.start, completions
+}
+
+// splitCompletionWord finds the word at the end of line, following the shell's
+// quoting, and whether it is in command position: the first word of a command,
+// after any assignments and after a separator, pipe or opening parenthesis
+func splitCompletionWord(line []rune) completionWord {
+	word := completionWord{start: len(line), command: true}
+	var value []rune
+	inWord := false
+
+	begin := func(i int) {
+		if !inWord {
+			inWord = true
+			word.start = i
+			value = value[:0]
+		}
+	}
+	end := func(i int) {
+		if !inWord {
+			return
+		}
+		inWord = false
+		switch {
+		case word.redirect:
+			word.redirect = false
+		case word.command && (isAssignmentWord(string(value)) || isPrefixKeyword(string(value))):
+		default:
+			if word.command {
+				word.name = string(value)
+				word.command = false
+			}
+			word.words = append(word.words, string(line[word.start:i]))
+		}
+	}
+
+	for i := 0; i < len(line); i++ {
+		r := line[i]
+		switch {
+		case word.quote == '\'':
+			if r == '\'' {
+				word.quote = 0
+			} else {
+				value = append(value, r)
+			}
+		case word.quote == '"':
+			switch {
+			case r == '"':
+				word.quote = 0
+			case r == '\\' && i+1 < len(line) && strings.ContainsRune("$`\"\\", line[i+1]):
+				i++
+				value = append(value, line[i])
+			default:
+				value = append(value, r)
+			}
+		case r == '\\':
+			begin(i)
+			if i+1 < len(line) {
+				i++
+				value = append(value, line[i])
+			}
+		case r == '\'' || r == '"':
+			begin(i)
+			word.quote = r
+		case unicode.IsSpace(r):
+			end(i)
+		case r == '<' || r == '>':
+			// A descriptor number before the operator is part of it, not a word
+			if inWord && strings.Trim(string(value), "0123456789") == "" && !word.redirect {
+				inWord = false
+			}
+			end(i)
+			word.redirect = true
+		case strings.ContainsRune(";&|()", r):
+			// ">&" and ">|" continue a redirection operator
+			if word.redirect && !inWord && i > 0 && (line[i-1] == '>' || line[i-1] == '<') {
+				continue
+			}
+			end(i)
+			word.redirect = false
+			word.command = true
+			word.name = ""
+			word.words = nil
+		default:
+			begin(i)
+			value = append(value, r)
+		}
+	}
+
+	if !inWord {
+		word.start = len(line)
+		value = value[:0]
+	}
+	word.raw = string(line[word.start:])
+	word.value = string(value)
+	word.command = word.command && !word.redirect
+	if !word.redirect {
+		word.words = append(word.words, word.raw)
+		word.cword = len(word.words) - 1
+	}
+	return word
+}
+
+// isAssignmentWord reports whether a word is a variable assignment, which may
+// come before a command name
+func isAssignmentWord(word string) bool {
+	name, _, ok := strings.Cut(word, "=")
+	return ok && isName(name)
+}
+
+// isPrefixKeyword reports whether a word is a keyword that a command follows
+func isPrefixKeyword(word string) bool {
+	switch word {
+	case "time", "coproc", "!":
+		return true
+	}
+	return false
+}
+
+// quoteCompletion quotes a completed word for the line: inside the quote the word
+// was started with, closing it if the word is complete, or with backslashes
+func quoteCompletion(text string, quote rune, complete bool) string {
+	var sb strings.Builder
+	switch quote {
+	case '\'':
+		sb.WriteRune(quote)
+		sb.WriteString(strings.ReplaceAll(text, "'", `'\''`))
+	case '"':
+		sb.WriteRune(quote)
+		for _, r := range text {
+			if strings.ContainsRune("$`\"\\", r) {
+				sb.WriteByte('\\')
+			}
+			sb.WriteRune(r)
+		}
+	default:
+		for _, r := range text {
+			if strings.ContainsRune(specialChars, r) {
+				sb.WriteByte('\\')
+			}
+			sb.WriteRune(r)
+		}
+		return sb.String()
+	}
+	if complete {
+		sb.WriteRune(quote)
+	}
+	return sb.String()
+}
+
+// commandNames returns the builtins and PATH executables starting with prefix,
+// sorted and without duplicates. The shell has no aliases or functions to add.
+func (s *Shell) commandNames(prefix string) []string {
+	var candidates []string
+	if registry, ok := s.builtins.(BuiltinRegistryWithNames); ok {
+		candidates = append(candidates, registry.Names()...)
+	}
+	candidates = append(candidates, s.commands.Names()...)
+
+	var names []string
+	for _, name := range candidates {
+		if strings.HasPrefix(name, prefix) && name != commandNotFoundHandle {
+			names = append(names, name)
+		}
+	}
+	return sortedUnique(names)
+}
+
+// variableNames returns the names of the set variables starting with prefix
+func (s *Shell) variableNames(prefix string) []string {
+	var names []string
+	for _, v := range s.vars.Variables() {
+		if v.Set && strings.HasPrefix(v.Name, prefix) {
+			names = append(names, v.Name)
+		}
+	}
+	return names
+}
+
+// pathNames returns the paths starting with prefix, spelled as the prefix spells its
+// directory, including ~ and ~user. Hidden files are only included when the name
+// being completed starts with a dot. With dirsOnly, only directories are returned.
+func (s *Shell) pathNames(prefix string, dirsOnly bool) []string {
+	dir, base := "", prefix
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		dir, base = prefix[:i+1], prefix[i+1:]
+	}
+	readDir := s.expandHome(dir)
+	if readDir == "" {
+		readDir = "."
+	}
+
+	entries, err := os.ReadDir(readDir)
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, base) || strings.HasPrefix(name, ".") && !strings.HasPrefix(base, ".") {
+			continue
+		}
+		if dirsOnly {
+			// Symbolic links to directories count as directories
+			if info, err := os.Stat(filepath.Join(readDir, name)); err != nil || !info.IsDir() {
+				continue
+			}
+		}
+		names = append(names, dir+name)
+	}
+	return names
+}
+
+// expandHome expands a leading ~ or ~user in a path, as the shell would
+func (s *Shell) expandHome(path string) string {
+	if !strings.HasPrefix(path, "~") {
+		return path
+	}
+	name, _, _ := strings.Cut(path[1:], "/")
+	home := s.homeDir(name)
+	if home == "" {
+		return path
+	}
+	return home + path[1+len(name):]
+}
+
+// userNames returns the names of the users in the password file starting with prefix
+func userNames(prefix string) []string {
+	f, err := os.Open(passwdFile)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var names []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		name, _, ok := strings.Cut(scanner.Text(), ":")
+		if ok && name != "" && !strings.HasPrefix(name, "#") && strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	return sortedUnique(names)
+}
+
+// sortedUnique sorts names and removes duplicates
+func sortedUnique(names []string) []string {
+	sort.Strings(names)
+	unique := names[:0]
+	for i, name := range names {
+		if i == 0 || name != names[i-1] {
+			unique = append(unique, name)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,382 @@
+package shell
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/shell-starter-go/app/internal/lineedit"
+	"github.com/codecrafters-io/shell-starter-go/app/syntax"
+)
+
+// completeUsage is the error for a complete command without a name to define
+const completeUsage = "complete: usage: complete [-bcdfuv] [-pr] [-o option] [-A action] [-W wordlist] [-F function] [name ...]"
+
+// compActions are the kinds of names -A completes, with the options that are short for them
+var compActions = []struct {
+	name string
+	flag rune
+}{
+	{"builtin", 'b'},
+	{"command", 'c'},
+	{"directory", 'd'},
+	{"file", 'f'},
+	{"user", 'u'},
+	{"variable", 'v'},
+}
+
+// compSpec is a completion specification, how the complete builtin says the arguments
+// of a command are completed
+type compSpec struct {
+	// actions are the kinds of names to complete, from compActions
+	actions map[string]bool
+	// wordlist is the -W list, expanded and split each time it is used
+	wordlist    string
+	hasWordlist bool
+	// function is the -F command that computes completions. The shell has no functions,
+	// so it is a builtin, such as one an embedder registers, or a program.
+	function string
+	// noSpace and filenames are set by -o nospace and -o filenames
+	noSpace, filenames bool
+}
+
+// String returns the complete command that defines the specification for name
+func (c *compSpec) String(name string) string {
+	words := []string{"complete"}
+	if c.filenames {
+		words = append(words, "-o", "filenames")
+	}
+	if c.noSpace {
+		words = append(words, "-o", "nospace")
+	}
+	for _, action := range compActions {
+		if c.actions[action.name] {
+			words = append(words, "-"+string(action.flag))
+		}
+	}
+	if c.hasWordlist {
+		words = append(words, "-W", syntax.Quote(c.wordlist))
+	}
+	if c.function != "" {
+		words = append(words, "-F", syntax.Quote(c.function))
+	}
+	return strings.Join(append(words, syntax.Quote(name)), " ")
+}
+
+// parseCompOptions parses the options that complete and compgen share into spec and
+// returns the remaining arguments. For complete, it also returns whether -p or -r was given.
+func parseCompOptions(builtin string, args []string, spec *compSpec) (rest []string, print, remove bool, err error) {
+	for len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' {
+		arg := args[0]
+		args = args[1:]
+		if arg == "--" {
+			break
+		}
+	options:
+		for i, c := range arg[1:] {
+			for _, action := range compActions {
+				if c == action.flag {
+					spec.actions[action.name] = true
+					continue options
+				}
+			}
+
+			switch c {
+			case 'p', 'r':
+				if builtin != "complete" {
+					return nil, false, false, fmt.Errorf("%s: -%c: invalid option", builtin, c)
+				}
+				print = print || c == 'p'
+				remove = remove || c == 'r'
+				continue
+			case 'A', 'W', 'F', 'o':
+			default:
+				return nil, false, false, fmt.Errorf("%s: -%c: invalid option", builtin, c)
+			}
+
+			// The value is the rest of the word or the next argument
+			var value string
+			if v := arg[2+i:]; v != "" {
+				value = v
+			} else if len(args) > 0 {
+				value, args = args[0], args[1:]
+			} else {
+				return nil, false, false, fmt.Errorf("%s: -%c: option requires an argument", builtin, c)
+			}
+
+			switch c {
+			case 'A':
+				found := false
+				for _, action := range compActions {
+					if value == action.name {
+						spec.actions[value] = true
+						found = true
+					}
+				}
+				if !found {
+					return nil, false, false, fmt.Errorf("%s: %s: invalid action name", builtin, value)
+				}
+			case 'W':
+				spec.wordlist = value
+				spec.hasWordlist = true
+			case 'F':
+				spec.function = value
+			case 'o':
+				switch value {
+				case "nospace":
+					spec.noSpace = true
+				case "filenames":
+					spec.filenames = true
+				default:
+					return nil, false, false, fmt.Errorf("%s: %s: invalid option name", builtin, value)
+				}
+			}
+			break
+		}
+	}
+	return args, print, remove, nil
+}
+
+// handleComplete handles the 'complete' built-in command:
+// "complete [-bcdfuv] [-pr] [-o option] [-A action] [-W wordlist] [-F function] [name ...]".
+// It defines how the arguments of the named commands are completed, or with -p or without
+// options prints the definitions and with -r removes them.
+func (s *Shell) handleComplete(args []string, stdout, stderr io.Writer) error {
+	spec := &compSpec{actions: make(map[string]bool)}
+	names, print, remove, err := parseCompOptions("complete", args, spec)
+	if err != nil {
+		return err
+	}
+	if err := s.checkCompFunction("complete", spec); err != nil {
+		return err
+	}
+
+	switch {
+	case remove:
+		if len(names) == 0 {
+			s.compSpecs = make(map[string]*compSpec)
+			return nil
+		}
+		for _, name := range names {
+			if s.compSpecs[name] == nil {
+				err = fmt.Errorf("complete: %s: no completion specification", name)
+				continue
+			}
+			delete(s.compSpecs, name)
+		}
+		return err
+	case print || len(args) == 0:
+		if len(names) == 0 {
+			for name := range s.compSpecs {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+		}
+		for _, name := range names {
+			if s.compSpecs[name] == nil {
+				err = fmt.Errorf("complete: %s: no completion specification", name)
+				continue
+			}
+			fmt.Fprintln(stdout, s.compSpecs[name].String(name))
+		}
+		return err
+	case len(names) == 0:
+		return fmt.Errorf("%s", completeUsage)
+	}
+
+	for _, name := range names {
+		s.compSpecs[name] = spec
+	}
+	return nil
+}
+
+// handleCompgen handles the 'compgen' built-in command:
+// "compgen [-bcdfuv] [-o option] [-A action] [-W wordlist] [-F function] [word]".
+// It prints the completions of word that a specification with the same options generates.
+func (s *Shell) handleCompgen(args []string, stdout, stderr io.Writer) error {
+	spec := &compSpec{actions: make(map[string]bool)}
+	args, _, _, err := parseCompOptions("compgen", args, spec)
+	if err != nil {
+		return err
+	}
+	if err := s.checkCompFunction("compgen", spec); err != nil {
+		return err
+	}
+	word := completionWord{}
+	if len(args) > 0 {
+		word.value = args[0]
+		word.words = []string{args[0]}
+	}
+
+	matches := s.compMatches(spec, word, nil)
+	if len(matches) == 0 {
+		return exitStatus(1)
+	}
+	for _, match := range matches {
+		fmt.Fprintln(stdout, match)
+	}
+	return nil
+}
+
+// checkCompFunction returns an error if restricted mode forbids running the -F command
+// of a specification, which would otherwise run programs the shell refuses to
+func (s *Shell) checkCompFunction(builtin string, spec *compSpec) error {
+	if spec.function == "" {
+		return nil
+	}
+	if err := s.checkRestricted(nil, []string{spec.function}); err != nil {
+		return fmt.Errorf("%s: %s", builtin, err.Error())
+	}
+	return nil
+}
+
+// compMatches returns what a specification generates for a word: the names of its
+// actions and the words of its word list that start with the word, then whatever its
+// function returns. line is the command line being completed, or nil for compgen.
+func (s *Shell) compMatches(spec *compSpec, word completionWord, line []rune) []string {
+	var matches []string
+	for _, action := range compActions {
+		if !spec.actions[action.name] {
+			continue
+		}
+		switch action.name {
+		case "builtin":
+			if registry, ok := s.builtins.(BuiltinRegistryWithNames); ok {
+				for _, name := range registry.Names() {
+					if strings.HasPrefix(name, word.value) {
+						matches = append(matches, name)
+					}
+				}
+			}
+		case "command":
+			matches = append(matches, s.commandNames(word.value)...)
+		case "directory":
+			matches = append(matches, s.pathNames(word.value, true)...)
+		case "file":
+			matches = append(matches, s.pathNames(word.value, false)...)
+		case "user":
+			matches = append(matches, userNames(word.value)...)
+		case "variable":
+			matches = append(matches, s.variableNames(word.value)...)
+		}
+	}
+
+	if spec.hasWordlist {
+		for _, w := range s.expandWordlist(spec.wordlist) {
+			if strings.HasPrefix(w, word.value) {
+				matches = append(matches, w)
+			}
+		}
+	}
+
+	if spec.function != "" {
+		matches = append(matches, s.compFunction(spec.function, word, line)...)
+	}
+	return matches
+}
+
+// expandWordlist expands a -W word list as the shell expands a command's arguments
+func (s *Shell) expandWordlist(wordlist string) []string {
+	file, err := syntax.Parse(wordlist, "")
+	if err != nil {
+		return nil
+	}
+	var words []string
+	for _, stmt := range file.Stmts {
+		for _, word := range stmt.Cmd.Args {
+			words = append(words, s.expandFields(word)...)
+		}
+	}
+	return words
+}
+
+// compFunction runs the -F command of a specification with the command name, the word
+// and the word before it as arguments, and returns the elements of COMPREPLY it sets or
+// else the lines it prints. While it runs, COMP_WORDS holds the words of the command
+// line, COMP_CWORD the index of the word, and COMP_LINE and COMP_POINT the line and the
+// cursor's byte offset in it; the last three are also in a program's environment.
+// Under dryrun the command is not run and completes nothing.
+func (s *Shell) compFunction(function string, word completionWord, line []rune) []string {
+	if s.option("dryrun") {
+		return nil
+	}
+	prev := ""
+	if word.cword > 0 {
+		prev = word.words[word.cword-1]
+	}
+
+	var assigns []assignment
+	if line != nil {
+		assigns = []assignment{
+			{name: "COMP_CWORD", value: strconv.Itoa(word.cword)},
+			{name: "COMP_LINE", value: string(line)},
+			{name: "COMP_POINT", value: strconv.Itoa(len(string(line)))},
+		}
+		s.vars.SetArray("COMP_WORDS", word.words)
+		for _, a := range assigns {
+			s.vars.Set(a.name, a.value)
+		}
+		defer func() {
+			s.vars.Unset("COMP_WORDS")
+			for _, a := range assigns {
+				s.vars.Unset(a.name)
+			}
+		}()
+	}
+	s.vars.Unset("COMPREPLY")
+
+	var out bytes.Buffer
+	s.runCommand(function, []string{word.name, word.value, prev}, s.vars.Environ(assigns), strings.NewReader(""), &out, s.stderr)
+
+	if reply := s.vars.Lookup("COMPREPLY"); reply != nil && reply.Set {
+		if reply.Elements != nil {
+			return reply.Elements
+		}
+		return []string{reply.Value}
+	}
+	var lines []string
+	for _, l := range strings.Split(out.String(), "\n") {
+		if l != "" {
+			lines = append(lines, l)
+		}
+	}
+	return lines
+}
+
+// programmableCompletions completes a word with the specification defined for its command
+func (s *Shell) programmableCompletions(spec *compSpec, word completionWord, line []rune) []lineedit.Completion {
+	matches := sortedUnique(s.compMatches(spec, word, line))
+	var completions []lineedit.Completion
+	for _, match := range matches {
+		if spec.filenames {
+			completion := s.fileCompletion(match, word.quote, len(matches) == 1)
+			completion.NoSpace = completion.NoSpace || spec.noSpace
+			completions = append(completions, completion)
+			continue
+		}
+		completions = append(completions, lineedit.Completion{Text: match, NoSpace: spec.noSpace})
+	}
+	return completions
+}
+
+// fileCompletion returns the completion of a path, quoted for the line. Only the last
+// element of the path is listed, and a directory gets a slash and no space after it.
+func (s *Shell) fileCompletion(path string, quote rune, unique bool) lineedit.Completion {
+	display := filepath.Base(path)
+	info, err := os.Stat(s.expandHome(path))
+	dir := err == nil && info.IsDir()
+	if dir {
+		path += "/"
+		display += "/"
+	}
+	return lineedit.Completion{
+		Text:    quoteCompletion(path, quote, unique && !dir),
+		Display: display,
+		NoSpace: dir,
+	}
+}
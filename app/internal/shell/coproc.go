@@ -0,0 +1,93 @@
+package shell
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/codecrafters-io/shell-starter-go/app/internal/executor"
+	"github.com/codecrafters-io/shell-starter-go/app/syntax"
+)
+
+// defaultCoprocName names a coprocess started without a name
+const defaultCoprocName = "COPROC"
+
+// coprocFdMin is the lowest descriptor given to a coprocess's pipes, keeping them
+// clear of the small numbers scripts pick for "exec 3> file"
+const coprocFdMin = 60
+
+// coprocName splits the name of a coprocess off its expanded words. As the shell
+// only runs simple commands, "coproc NAME cmd" is told apart from "coproc cmd args"
+// by the first word: it names the coprocess if it is a valid name that is neither a
+// builtin nor a command found in PATH.
+func (s *Shell) coprocName(args []string) (string, []string) {
+	if len(args) > 1 && isName(args[0]) && !s.builtins.IsBuiltin(args[0]) && s.executor.FindCommand(args[0]) == "" {
+		return args[0], args[1:]
+	}
+	return defaultCoprocName, args
+}
+
+// startCoproc starts an external command asynchronously with its standard input and
+// output connected to pipes. The shell's ends of the pipes are added to its descriptor
+// table, at the descriptors stored in ${NAME[0]}, to read the command's output, and
+// ${NAME[1]}, to write to its input. $NAME_PID is its process ID and the command is
+// added to the job table, so that wait and read -u work with it.
+func (s *Shell) startCoproc(stmt *syntax.Stmt, name string, args, env []string, stderr io.Writer) int {
+	starter, ok := s.executor.(CommandExecutorWithJobs)
+	fds, fdsOK := s.ioManager.(IOManagerWithDescriptors)
+	if !ok || !fdsOK {
+		fmt.Fprintf(stderr, "coproc: not supported\n")
+		return 1
+	}
+	// A builtin would need a subshell to run alongside the shell
+	if s.builtins.IsBuiltin(args[0]) {
+		fmt.Fprintf(stderr, "coproc: %s: cannot run a builtin as a coprocess\n", args[0])
+		return 1
+	}
+	for _, variable := range []string{name, name + "_PID"} {
+		if v := s.vars.Lookup(variable); v != nil && v.ReadOnly {
+			fmt.Fprintf(stderr, "coproc: %s: readonly variable\n", variable)
+			return 1
+		}
+	}
+	if err := s.checkRestrictedNames(name, name+"_PID"); err != nil {
+		fmt.Fprintf(stderr, "coproc: %s\n", err.Error())
+		return 1
+	}
+
+	// in and out are named from the coprocess's side
+	inR, inW, err := os.Pipe()
+	if err != nil {
+		fmt.Fprintf(stderr, "coproc: %v\n", err)
+		return 1
+	}
+	outR, outW, err := os.Pipe()
+	if err != nil {
+		inR.Close()
+		inW.Close()
+		fmt.Fprintf(stderr, "coproc: %v\n", err)
+		return 1
+	}
+
+	cmd, err := starter.Start(args[0], args[1:], env, inR, outW, stderr, -1)
+	// Only the coprocess keeps its ends open, so it sees end of input once the
+	// shell closes its write descriptor, and the shell sees end of output once it exits
+	inR.Close()
+	outW.Close()
+	if err != nil {
+		inW.Close()
+		outR.Close()
+		fmt.Fprintf(stderr, "%s\n", err.Error())
+		return executor.ExitStatus(err)
+	}
+
+	readFd := fds.OpenDescriptor(outR, false, coprocFdMin)
+	writeFd := fds.OpenDescriptor(inW, true, coprocFdMin)
+	s.vars.SetArray(name, []string{strconv.Itoa(readFd), strconv.Itoa(writeFd)})
+	s.vars.Set(name+"_PID", strconv.Itoa(cmd.Process.Pid))
+
+	job := s.jobs.Add(cmd, commandText(stmt))
+	fmt.Fprintf(s.stderr, "[%d] %d\n", job.ID, job.Pgid)
+	return 0
+}
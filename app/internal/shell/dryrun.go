@@ -0,0 +1,130 @@
+package shell
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/shell-starter-go/app/syntax"
+)
+
+// dryRunBuiltins are the builtins that still run in dry-run mode because they only
+// read shell state; set runs too, so that the mode can be turned off again
+var dryRunBuiltins = map[string]bool{
+	"echo": true,
+	"pwd":  true,
+	"type": true,
+	"jobs": true,
+	"set":  true,
+}
+
+// skipsDryRun reports whether the dryrun option stops a command from running:
+// external commands, builtins that change state and anything redirecting output
+// to a file are described instead. Assignments without a command still happen,
+// so that later commands are described with the values they would see.
+func (s *Shell) skipsDryRun(args []string, redirs []Redirection) bool {
+	if !s.option("dryrun") {
+		return false
+	}
+	for _, r := range redirs {
+		switch r.Mode {
+		case RedirectTruncate, RedirectAppend, RedirectClobber:
+			return true
+		}
+	}
+	if len(args) == 0 {
+		return false
+	}
+	return !s.builtins.IsBuiltin(args[0]) || !dryRunBuiltins[args[0]]
+}
+
+// describeDryRun prints what a command would do: its expanded words, the program
+// that would run, how its environment differs from the one the shell started with,
+// and its redirections
+func (s *Shell) describeDryRun(w io.Writer, assigns []assignment, args []string, redirs []Redirection, background bool) {
+	words := make([]string, 0, len(assigns)+len(args))
+	for _, a := range assigns {
+		words = append(words, a.name+"="+syntax.Quote(a.value))
+	}
+	for _, arg := range args {
+		words = append(words, syntax.Quote(arg))
+	}
+	fmt.Fprintf(w, "dry-run: %s\n", strings.Join(words, " "))
+
+	if len(args) > 0 {
+		switch path := s.executor.FindCommand(args[0]); {
+		case s.builtins.IsBuiltin(args[0]):
+			fmt.Fprintf(w, "  path: (builtin)\n")
+		case path == "":
+			fmt.Fprintf(w, "  path: (not found)\n")
+		default:
+			fmt.Fprintf(w, "  path: %s\n", path)
+			for _, change := range envDiff(s.environ, s.vars.Environ(assigns)) {
+				fmt.Fprintf(w, "  env: %s\n", change)
+			}
+		}
+	}
+	for _, r := range redirs {
+		fmt.Fprintf(w, "  redirect: %s\n", describeRedirection(r))
+	}
+	if background {
+		fmt.Fprintf(w, "  background\n")
+	}
+}
+
+// envDiff lists how the environment after differs from before, as "+name=value"
+// for variables that are new or changed and "-name" for ones that were removed
+func envDiff(before, after []string) []string {
+	old := make(map[string]string, len(before))
+	for _, entry := range before {
+		name, value, _ := strings.Cut(entry, "=")
+		old[name] = value
+	}
+
+	var changes []string
+	for _, entry := range after {
+		name, value, _ := strings.Cut(entry, "=")
+		if prev, ok := old[name]; !ok || prev != value {
+			changes = append(changes, "+"+name+"="+syntax.Quote(value))
+		}
+		delete(old, name)
+	}
+	for name := range old {
+		changes = append(changes, "-"+name)
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i][1:] < changes[j][1:]
+	})
+	return changes
+}
+
+// describeRedirection renders a redirection the way it would be written
+func describeRedirection(r Redirection) string {
+	switch r.Mode {
+	case RedirectInput:
+		return fdPrefix(r.Fd, 0) + "<" + syntax.Quote(r.Target)
+	case RedirectHeredoc:
+		return fdPrefix(r.Fd, 0) + "<< (here-document)"
+	case RedirectDuplicate:
+		if r.Input {
+			return strconv.Itoa(r.Fd) + "<&" + r.Target
+		}
+		return strconv.Itoa(r.Fd) + ">&" + r.Target
+	case RedirectAppend:
+		return fdPrefix(r.Fd, 1) + ">>" + syntax.Quote(r.Target)
+	case RedirectClobber:
+		return fdPrefix(r.Fd, 1) + ">|" + syntax.Quote(r.Target)
+	}
+	return fdPrefix(r.Fd, 1) + ">" + syntax.Quote(r.Target)
+}
+
+// fdPrefix returns the descriptor number to write before a redirection operator,
+// which is left out when it is the operator's default
+func fdPrefix(fd, defaultFd int) string {
+	if fd == defaultFd {
+		return ""
+	}
+	return strconv.Itoa(fd)
+}
@@ -0,0 +1,191 @@
+package shell
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"syscall"
+
+	"github.com/codecrafters-io/shell-starter-go/app/internal/executor"
+)
+
+// handleExec handles the 'exec' built-in command: "exec [-cl] [-a name] [command [args...]]".
+// The command replaces the shell process. Without a command, executeStmt makes exec's
+// redirections permanent instead.
+func (s *Shell) handleExec(args []string, stdout, stderr io.Writer) error {
+	var argv0 string
+	var clearEnv, login bool
+	for len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' {
+		arg := args[0]
+		args = args[1:]
+		if arg == "--" {
+			break
+		}
+		for i, c := range arg[1:] {
+			switch c {
+			case 'c':
+				clearEnv = true
+			case 'l':
+				login = true
+			case 'a':
+				// The name is the rest of the word or the next argument
+				if rest := arg[2+i:]; rest != "" {
+					argv0 = rest
+				} else if len(args) > 0 {
+					argv0, args = args[0], args[1:]
+				} else {
+					return fmt.Errorf("exec: -a: option requires an argument")
+				}
+			default:
+				return fmt.Errorf("exec: -%c: invalid option", c)
+			}
+			if c == 'a' {
+				break
+			}
+		}
+	}
+	if len(args) == 0 {
+		return nil
+	}
+
+	// Everything that can be checked is checked before the EXIT trap runs and the
+	// streams are replaced, which cannot be undone
+	name := args[0]
+	path := name
+	if !strings.Contains(name, "/") {
+		if path = s.executor.FindCommand(name); path == "" {
+			return fmt.Errorf("exec: %s: not found", name)
+		}
+	}
+	if _, err := executor.ResolveCommand(path); err != nil {
+		return fmt.Errorf("exec: %s", err.Error())
+	}
+	if argv0 == "" {
+		argv0 = name
+	}
+	if login {
+		argv0 = "-" + argv0
+	}
+	env := s.vars.Environ(nil)
+	if clearEnv {
+		env = []string{}
+	}
+
+	// The EXIT trap runs once, as on exit, unless exec fails and the shell goes on
+	exitAction, trapped := s.traps.Action(trapExit)
+	s.runTrap(trapExit)
+	s.traps.Reset(trapExit)
+	restoreTrap := func() {
+		if trapped {
+			s.traps.Set(trapExit, exitAction)
+		}
+	}
+
+	// The process is replaced without running exit, so record the command and
+	// flush the audit log here
+	argv := append([]string{argv0}, args[1:]...)
+	s.auditExec(path, argv)
+
+	// The program gets the descriptors a command would, which may replace ones the
+	// shell itself uses, such as the audit log's, so they are installed last
+	stdin := s.stdin
+	if ioManager, ok := s.ioManager.(IOManagerWithRedirections); ok && ioManager.GetCurrentStdin() != nil {
+		stdin = ioManager.GetCurrentStdin()
+	}
+	streams := []any{stdin, stdout, stderr}
+	for _, file := range s.extraFiles {
+		streams = append(streams, file)
+	}
+	restoreDescriptors, err := installDescriptors(streams)
+	if err == nil {
+		if execer, ok := s.executor.(CommandExecutorWithExec); ok {
+			err = execer.Exec(path, argv, env)
+		} else {
+			err = syscall.Exec(path, argv, env)
+		}
+		restoreDescriptors()
+	}
+	// The shell goes on with its own descriptors and trap, and the statement is
+	// recorded again with its failure
+	restoreTrap()
+	if s.auditing != nil {
+		s.auditing.recorded = false
+	}
+	return fmt.Errorf("exec: %s: %v", name, err)
+}
+
+// savedDescriptor is a close-on-exec copy of a descriptor that installDescriptors
+// replaced, or -1 if it was closed
+type savedDescriptor struct {
+	dup     int
+	cloexec bool
+}
+
+// installDescriptors makes the file at index i of streams the process's descriptor i,
+// without close-on-exec, because a program replacing the shell only inherits
+// descriptors. Streams that are not files, such as an embedder's buffers, and nil files
+// are left alone. It returns a function that puts the replaced descriptors back, for
+// when exec fails.
+func installDescriptors(streams []any) (restore func(), err error) {
+	// The files are copied first, so that installing one cannot replace another
+	sources := make(map[int]int)
+	defer func() {
+		for _, source := range sources {
+			syscall.Close(source)
+		}
+	}()
+	for fd, stream := range streams {
+		file, ok := stream.(*os.File)
+		if !ok || file == nil {
+			continue
+		}
+		source, err := dupAbove(int(file.Fd()), len(streams))
+		if err != nil {
+			return nil, err
+		}
+		sources[fd] = source
+	}
+
+	saved := make(map[int]savedDescriptor)
+	restore = func() {
+		for fd, s := range saved {
+			if s.dup < 0 {
+				syscall.Close(fd)
+				continue
+			}
+			flags := 0
+			if s.cloexec {
+				flags = syscall.O_CLOEXEC
+			}
+			syscall.Dup3(s.dup, fd, flags)
+			syscall.Close(s.dup)
+		}
+	}
+	for fd, source := range sources {
+		s := savedDescriptor{dup: -1}
+		if flags, _, errno := syscall.Syscall(syscall.SYS_FCNTL, uintptr(fd), syscall.F_GETFD, 0); errno == 0 {
+			if s.dup, err = dupAbove(fd, len(streams)); err != nil {
+				restore()
+				return nil, err
+			}
+			s.cloexec = flags&syscall.FD_CLOEXEC != 0
+		}
+		saved[fd] = s
+		if err := syscall.Dup3(source, fd, 0); err != nil {
+			restore()
+			return nil, err
+		}
+	}
+	return restore, nil
+}
+
+// dupAbove returns a close-on-exec copy of fd numbered min or above, which
+// installing descriptors below min cannot replace
+func dupAbove(fd, min int) (int, error) {
+	dup, _, errno := syscall.Syscall(syscall.SYS_FCNTL, uintptr(fd), syscall.F_DUPFD_CLOEXEC, uintptr(min))
+	if errno != 0 {
+		return -1, errno
+	}
+	return int(dup), nil
+}
@@ -0,0 +1,274 @@
+package shell
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/shell-starter-go/app/syntax"
+)
+
+// defaultIFS separates fields when IFS is unset
+const defaultIFS = " \t\n"
+
+// expandWord returns the value of a word after parameter expansion and quote removal,
+// without field splitting, as for redirection targets and assignment values
+func (s *Shell) expandWord(word *syntax.Word) string {
+	var sb strings.Builder
+	home, parts := s.expandTilde(word.Parts)
+	sb.WriteString(home)
+	s.expandParts(&sb, parts, false)
+	return sb.String()
+}
+
+// expandTilde expands a leading unquoted ~ to $HOME and ~user to that user's home
+// directory, up to the first '/'. It returns the directory, or "" if the word does not
+// start with a tilde or the user does not exist, and the parts that follow it.
+func (s *Shell) expandTilde(parts []syntax.WordPart) (string, []syntax.WordPart) {
+	if len(parts) == 0 {
+		return "", parts
+	}
+	lit, ok := parts[0].(*syntax.Lit)
+	if !ok || !strings.HasPrefix(lit.Value, "~") {
+		return "", parts
+	}
+	prefix, rest, slash := strings.Cut(lit.Value, "/")
+	// "~user" must be the whole prefix, not "~user" followed by quotes or an expansion
+	if !slash && len(parts) > 1 {
+		return "", parts
+	}
+
+	home := s.homeDir(prefix[1:])
+	if home == "" {
+		return "", parts
+	}
+
+	remaining := parts[1:]
+	if slash {
+		remaining = append([]syntax.WordPart{&syntax.Lit{ValuePos: lit.ValuePos, Value: "/" + rest}}, remaining...)
+	}
+	return home, remaining
+}
+
+// homeDir returns the home directory of the named user, or $HOME for an empty name,
+// and "" if there is none
+func (s *Shell) homeDir(name string) string {
+	if name == "" {
+		home, _ := s.variable("HOME")
+		return home
+	}
+	if u, err := user.Lookup(name); err == nil {
+		return u.HomeDir
+	}
+	return ""
+}
+
+// expandParts appends the values of word parts to sb
+func (s *Shell) expandParts(sb *strings.Builder, parts []syntax.WordPart, dquoted bool) {
+	for _, part := range parts {
+		switch part := part.(type) {
+		case *syntax.Lit:
+			sb.WriteString(syntax.Unescape(part.Value, dquoted))
+		case *syntax.SglQuoted:
+			sb.WriteString(part.Value)
+		case *syntax.DblQuoted:
+			s.expandParts(sb, part.Parts, true)
+		case *syntax.ParamExp:
+			sb.WriteString(s.paramValue(part))
+		}
+	}
+}
+
+// expandHeredoc expands the body of a here-document whose delimiter is not quoted. It
+// is expanded like a double-quoted string in which '"' is an ordinary character:
+// parameters expand and a backslash only escapes '$', '`', '\' and a newline.
+func (s *Shell) expandHeredoc(body string) string {
+	var sb strings.Builder
+	for _, part := range syntax.ParseQuoted(body).Parts {
+		switch part := part.(type) {
+		case *syntax.Lit:
+			value := []rune(part.Value)
+			for i := 0; i < len(value); i++ {
+				if value[i] == '\\' && i+1 < len(value) && strings.ContainsRune("$`\\", value[i+1]) {
+					i++
+				}
+				sb.WriteRune(value[i])
+			}
+		case *syntax.ParamExp:
+			sb.WriteString(s.paramValue(part))
+		}
+	}
+	return sb.String()
+}
+
+// quotedWord reports whether any part of a word is quoted or escaped, which for a
+// here-document's delimiter keeps its body from being expanded
+func quotedWord(word *syntax.Word) bool {
+	for _, part := range word.Parts {
+		if lit, ok := part.(*syntax.Lit); !ok || strings.ContainsRune(lit.Value, '\\') {
+			return true
+		}
+	}
+	return false
+}
+
+// expandFields expands a command word into fields. The results of unquoted expansions
+// are split on the characters of IFS, while quoted text is never split; a word that
+// expands to nothing and has no quotes produces no field at all.
+func (s *Shell) expandFields(word *syntax.Word) []string {
+	ifs, ok := s.variable("IFS")
+	if !ok {
+		ifs = defaultIFS
+	}
+
+	var fields []string
+	var field strings.Builder
+	// The home directory of a tilde prefix is never split
+	home, parts := s.expandTilde(word.Parts)
+	field.WriteString(home)
+	// inField is set once the current field exists, even if it is still empty
+	inField := home != ""
+	// afterBlank is set after a field ended at IFS whitespace, which absorbs a following delimiter
+	afterBlank := false
+	for _, part := range parts {
+		param, ok := part.(*syntax.ParamExp)
+		if !ok {
+			s.expandParts(&field, []syntax.WordPart{part}, false)
+			inField = true
+			afterBlank = false
+			continue
+		}
+
+		for _, c := range s.paramValue(param) {
+			switch {
+			case !strings.ContainsRune(ifs, c):
+				field.WriteRune(c)
+				inField = true
+				afterBlank = false
+			case strings.ContainsRune(defaultIFS, c):
+				if inField {
+					fields = append(fields, field.String())
+					field.Reset()
+					inField = false
+					afterBlank = true
+				}
+			default:
+				if inField || !afterBlank {
+					fields = append(fields, field.String())
+					field.Reset()
+				}
+				inField = false
+				afterBlank = false
+			}
+		}
+	}
+	if inField {
+		fields = append(fields, field.String())
+	}
+	return fields
+}
+
+// paramValue returns the value of a parameter expansion. Unset variables expand to
+// nothing; ${name[n]} expands to an element of an array. Expansions with operators
+// such as ${name:-word} are not supported yet and are kept as written.
+func (s *Shell) paramValue(param *syntax.ParamExp) string {
+	switch param.Param {
+	case "?":
+		return strconv.Itoa(s.lastStatus)
+	case "$":
+		return strconv.Itoa(os.Getpid())
+	case "-":
+		return s.optionFlags()
+	}
+	if name, index, ok := subscript(param.Param); ok && !param.Short {
+		value, _ := s.vars.Element(name, index)
+		return value
+	}
+	if !isName(param.Param) {
+		if param.Short {
+			return "$" + param.Param
+		}
+		return "${" + param.Param + "}"
+	}
+	value, _ := s.variable(param.Param)
+	return value
+}
+
+// checkUnbound returns an error naming the first variable that a statement expands
+// but that is not set, for the nounset option
+func (s *Shell) checkUnbound(stmt *syntax.Stmt) error {
+	if !s.option("nounset") {
+		return nil
+	}
+	var err error
+	syntax.Walk(stmt, func(node syntax.Node) bool {
+		param, ok := node.(*syntax.ParamExp)
+		if !ok || err != nil {
+			return err == nil
+		}
+		set := true
+		if name, index, ok := subscript(param.Param); ok && !param.Short {
+			_, set = s.vars.Element(name, index)
+		} else if isName(param.Param) {
+			_, set = s.variable(param.Param)
+		}
+		if !set {
+			err = fmt.Errorf("%s: unbound variable", param.Param)
+		}
+		return true
+	})
+	return err
+}
+
+// subscript splits a parameter of the form name[n], where n is a decimal index,
+// into the array name and the index
+func subscript(param string) (name string, index int, ok bool) {
+	name, rest, found := strings.Cut(param, "[")
+	if !found || !isName(name) || !strings.HasSuffix(rest, "]") {
+		return "", 0, false
+	}
+	index, err := strconv.Atoi(strings.TrimSuffix(rest, "]"))
+	if err != nil || index < 0 {
+		return "", 0, false
+	}
+	return name, index, true
+}
+
+// expandAssignments splits the leading "name=value" words off a command and expands
+// their values. It returns the assignments and the remaining words.
+func (s *Shell) expandAssignments(words []*syntax.Word) ([]assignment, []*syntax.Word) {
+	var assigns []assignment
+	for i, word := range words {
+		name, value, ok := assignmentWord(word)
+		if !ok {
+			return assigns, words[i:]
+		}
+		assigns = append(assigns, assignment{name: name, value: s.expandWord(value)})
+	}
+	return assigns, nil
+}
+
+// assignmentWord reports whether a word is an assignment, which requires a valid
+// name followed by '=' written without quotes, and splits it into name and value
+func assignmentWord(word *syntax.Word) (name string, value *syntax.Word, ok bool) {
+	if len(word.Parts) == 0 {
+		return "", nil, false
+	}
+	lit, ok := word.Parts[0].(*syntax.Lit)
+	if !ok {
+		return "", nil, false
+	}
+	name, rest, found := strings.Cut(lit.Value, "=")
+	if !found || !isName(name) {
+		return "", nil, false
+	}
+
+	value = &syntax.Word{}
+	if rest != "" {
+		value.Parts = append(value.Parts, &syntax.Lit{ValuePos: lit.ValuePos, Value: rest})
+	}
+	value.Parts = append(value.Parts, word.Parts[1:]...)
+	return name, value, true
+}
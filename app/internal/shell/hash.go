@@ -0,0 +1,107 @@
+package shell
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/codecrafters-io/shell-starter-go/app/internal/errors"
+)
+
+// handleHash handles the 'hash' built-in command: "hash [-r] [-d] [-t] [-p path] [name ...]"
+func (s *Shell) handleHash(args []string, stdout, stderr io.Writer) error {
+	var reset, remove, printPaths bool
+	var path string
+	for len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' {
+		arg := args[0]
+		args = args[1:]
+		if arg == "--" {
+			break
+		}
+		for i, c := range arg[1:] {
+			switch c {
+			case 'r':
+				reset = true
+			case 'd':
+				remove = true
+			case 't':
+				printPaths = true
+			case 'p':
+				// The path is the rest of the word or the next argument
+				if rest := arg[2+i:]; rest != "" {
+					path = rest
+				} else if len(args) > 0 {
+					path, args = args[0], args[1:]
+				} else {
+					return fmt.Errorf("hash: -p: option requires an argument")
+				}
+			default:
+				return fmt.Errorf("hash: -%c: invalid option", c)
+			}
+			if c == 'p' {
+				break
+			}
+		}
+	}
+
+	if s.restricted && strings.Contains(path, "/") {
+		return fmt.Errorf("hash: %s", errors.NewRestrictedError(path, "").Error())
+	}
+	if reset {
+		s.hash.Clear()
+	}
+	if len(args) == 0 {
+		switch {
+		case reset:
+			return nil
+		case remove, printPaths, path != "":
+			return fmt.Errorf("hash: option requires a name argument")
+		}
+		return s.printHash(stdout)
+	}
+
+	var err error
+	for _, name := range args {
+		switch {
+		case remove:
+			if !s.hash.Delete(name) {
+				err = fmt.Errorf("hash: %s: not found", name)
+			}
+		case printPaths:
+			hashed, ok := s.hash.Get(name)
+			if !ok {
+				err = fmt.Errorf("hash: %s: not found", name)
+				continue
+			}
+			if len(args) > 1 {
+				fmt.Fprintf(stdout, "%s\t%s\n", name, hashed)
+			} else {
+				fmt.Fprintln(stdout, hashed)
+			}
+		case path != "":
+			s.hash.Add(name, path)
+		case s.builtins.IsBuiltin(name), strings.Contains(name, "/"):
+			// Builtins and paths are never looked up in PATH
+		default:
+			if _, ok := s.hash.Hash(name); !ok {
+				err = fmt.Errorf("hash: %s: not found", name)
+			}
+		}
+	}
+	return err
+}
+
+// printHash lists the remembered commands with their hit counts
+func (s *Shell) printHash(stdout io.Writer) error {
+	entries := s.hash.Entries()
+	if len(entries) == 0 {
+		fmt.Fprintln(stdout, "hash: hash table empty")
+		return nil
+	}
+
+	fmt.Fprintln(stdout, "hits\tcommand")
+	for _, entry := range entries {
+		fmt.Fprintf(stdout, "%4d\t%s\n", entry.Hits, entry.Path)
+	}
+	return nil
+}
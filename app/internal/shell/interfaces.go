@@ -2,8 +2,12 @@ package shell
 
 import (
 	"io"
+	"os"
+	"os/exec"
 
 	"github.com/codecrafters-io/shell-starter-go/app/internal/builtins"
+	"github.com/codecrafters-io/shell-starter-go/app/internal/executor"
+	"github.com/codecrafters-io/shell-starter-go/app/syntax"
 )
 
 // CommandParser defines the interface for parsing command lines
@@ -17,12 +21,54 @@ type CommandParserWithMode interface {
 	ParseLineWithMode(line string) (args []string, outputFile string, errorFile string, outputAppend bool, errorAppend bool, err error)
 }
 
+// CommandParserWithClobber extends CommandParserWithMode to recognize '>|', which
+// overwrites a file even when noclobber is set
+type CommandParserWithClobber interface {
+	CommandParserWithMode
+	ParseLineWithClobber(line string) (args []string, outputFile string, errorFile string, outputAppend bool, errorAppend bool, clobber bool, err error)
+}
+
 // CommandExecutor defines the interface for executing external commands
 type CommandExecutor interface {
-	Execute(command string, args []string, stdin io.Reader, stdout, stderr io.Writer)
+	Execute(command string, args []string, stdin io.Reader, stdout, stderr io.Writer) executor.ExecResult
 	FindCommand(commandName string) string
 }
 
+// CommandExecutorWithEnv extends CommandExecutor to run commands with an environment built by the shell
+type CommandExecutorWithEnv interface {
+	CommandExecutor
+	ExecuteWithEnv(command string, args, env []string, stdin io.Reader, stdout, stderr io.Writer) executor.ExecResult
+}
+
+// CommandExecutorWithJobs extends CommandExecutor to start commands without waiting for them
+type CommandExecutorWithJobs interface {
+	CommandExecutor
+	// Start runs the command with the given environment in a new process group;
+	// a tty other than -1 makes that group the terminal's foreground group
+	Start(command string, args, env []string, stdin io.Reader, stdout, stderr io.Writer, tty int) (*exec.Cmd, error)
+}
+
+// CommandExecutorWithHash extends CommandExecutor with a table of remembered command paths
+type CommandExecutorWithHash interface {
+	CommandExecutor
+	CommandHash() *executor.HashTable
+}
+
+// CommandExecutorWithExec extends CommandExecutor to control how exec replaces the shell,
+// so that an executor that confines commands confines them there too
+type CommandExecutorWithExec interface {
+	CommandExecutor
+	Exec(path string, argv, env []string) error
+}
+
+// CommandExecutorWithFiles extends CommandExecutor to pass descriptors above 2, such
+// as those opened by "exec 3>file", to the commands it runs
+type CommandExecutorWithFiles interface {
+	CommandExecutor
+	// SetExtraFiles sets the files commands inherit, the one at index i as descriptor 3+i
+	SetExtraFiles(files []*os.File)
+}
+
 // BuiltinRegistry defines the interface for managing built-in commands
 type BuiltinRegistry interface {
 	IsBuiltin(cmd string) bool
@@ -31,6 +77,25 @@ type BuiltinRegistry interface {
 	Register(cmd string, handler builtins.CommandHandler)
 }
 
+// BuiltinRegistryWithNames extends BuiltinRegistry to list the registered commands
+type BuiltinRegistryWithNames interface {
+	BuiltinRegistry
+	Names() []string
+}
+
+// BuiltinRegistryWithExit extends BuiltinRegistry so the shell can run its
+// EXIT trap before the exit builtin terminates the process
+type BuiltinRegistryWithExit interface {
+	BuiltinRegistry
+	SetExitHandler(handler func(code int))
+}
+
+// BuiltinRegistryWithHash extends BuiltinRegistry so that type can report hashed commands
+type BuiltinRegistryWithHash interface {
+	BuiltinRegistry
+	SetHashLookup(lookup func(string) (string, bool))
+}
+
 // IOManager defines the interface for handling input/output operations
 type IOManager interface {
 	SetupRedirection(outputFile, errorFile string) (cleanup func(), err error)
@@ -42,3 +107,61 @@ type IOManagerWithMode interface {
 	IOManager
 	SetupRedirectionWithMode(outputFile, errorFile string, outputAppend, errorAppend bool) (cleanup func(), err error)
 }
+
+// ScriptParser parses command lines into syntax trees.
+// When the parser provides it, the shell executes the tree instead of the flat ParseLine result.
+type ScriptParser interface {
+	Parse(src, name string) (*syntax.File, error)
+}
+
+// RedirectMode describes how a redirection opens its target
+type RedirectMode int
+
+// RedirectTruncate is '>', RedirectAppend is '>>', RedirectClobber is '>|',
+// RedirectInput is '<' and RedirectHeredoc is a here-document whose Target is its body.
+// RedirectDuplicate is '>&' or '<&', whose Target is a descriptor number, or '-' to close Fd.
+const (
+	RedirectTruncate RedirectMode = iota
+	RedirectAppend
+	RedirectClobber
+	RedirectInput
+	RedirectHeredoc
+	RedirectDuplicate
+)
+
+// Redirection describes a single redirection of a command's streams
+type Redirection struct {
+	Fd     int
+	Target string
+	Mode   RedirectMode
+	// Input is set for a RedirectDuplicate written as '<&', which only differs from
+	// '>&' in its default Fd
+	Input bool
+}
+
+// IOManagerWithRedirections extends IOManager to support arbitrary redirection lists
+type IOManagerWithRedirections interface {
+	IOManager
+	SetupRedirections(redirs []Redirection) (cleanup func(), err error)
+	// SetupPermanentRedirections applies redirections to the shell itself, as "exec 3>file" does
+	SetupPermanentRedirections(redirs []Redirection) error
+	GetCurrentStdin() io.Reader
+	SetNoclobber(enabled bool)
+	// SetRestricted refuses output redirections to files, as a restricted shell must
+	SetRestricted(enabled bool)
+}
+
+// IOManagerWithDescriptors extends IOManagerWithRedirections with access to descriptors
+// other than the standard ones, such as the pipes of a coprocess
+type IOManagerWithDescriptors interface {
+	IOManagerWithRedirections
+	// OpenDescriptor adds a file to the shell's own descriptor table at the lowest free
+	// descriptor not below min and returns it; the table then owns the file. Commands
+	// do not inherit the descriptor unless it is duplicated.
+	OpenDescriptor(file *os.File, write bool, min int) int
+	// ExtraFiles returns the files open at descriptors above 2 for the running command,
+	// the one for descriptor fd at index fd-3, with nil for the others
+	ExtraFiles() []*os.File
+	// Reader returns the reader of a descriptor open for reading
+	Reader(fd int) (io.Reader, error)
+}
@@ -3,6 +3,9 @@ package shell
 import (
 	"io"
 	"os"
+	"strconv"
+	"strings"
+	"syscall"
 
 	"github.com/codecrafters-io/shell-starter-go/app/internal/errors"
 )
@@ -11,18 +14,53 @@ import (
 type IOManagerImpl struct {
 	originalStdout io.Writer
 	originalStderr io.Writer
-	currentStdout  io.Writer
-	currentStderr  io.Writer
+	// fds is the shell's own descriptor table, changed only by permanent redirections
+	// and OpenDescriptor.
+	// Descriptor 0 is absent while commands read the shell's standard input.
+	fds map[int]stream
+	// current is the descriptor table in effect for the running command
+	current       map[int]stream
+	currentStdin  io.Reader
+	currentStdout io.Writer
+	currentStderr io.Writer
+	noclobber     bool
+	// restricted refuses redirections that open files for writing
+	restricted bool
+}
+
+// stream is an open descriptor in a descriptor table
+type stream struct {
+	r io.Reader
+	w io.Writer
+	// file is the file opened for the descriptor, if any
+	file *os.File
+	// cloexec keeps commands from inheriting the descriptor, as for a coprocess's
+	// pipes, which must close when the shell closes them
+	cloexec bool
 }
 
 // NewIOManager creates a new IO manager
 func NewIOManager(stdout, stderr io.Writer) *IOManagerImpl {
-	return &IOManagerImpl{
+	m := &IOManagerImpl{
 		originalStdout: stdout,
 		originalStderr: stderr,
-		currentStdout:  stdout,
-		currentStderr:  stderr,
+		fds: map[int]stream{
+			1: {w: stdout},
+			2: {w: stderr},
+		},
 	}
+	m.restore()
+	return m
+}
+
+// SetNoclobber controls whether '>' may overwrite existing regular files
+func (m *IOManagerImpl) SetNoclobber(enabled bool) {
+	m.noclobber = enabled
+}
+
+// SetRestricted controls whether redirections may open files for writing, as in a restricted shell
+func (m *IOManagerImpl) SetRestricted(enabled bool) {
+	m.restricted = enabled
 }
 
 // SetupRedirection sets up file redirection and returns a cleanup function
@@ -32,58 +70,244 @@ func (m *IOManagerImpl) SetupRedirection(outputFile, errorFile string) (cleanup
 
 // SetupRedirectionWithMode sets up file redirection with append mode support and returns a cleanup function
 func (m *IOManagerImpl) SetupRedirectionWithMode(outputFile, errorFile string, outputAppend, errorAppend bool) (cleanup func(), err error) {
-	var outFile, errFile *os.File
+	var redirs []Redirection
+	if outputFile != "" {
+		redirs = append(redirs, Redirection{Fd: 1, Target: outputFile, Mode: modeForAppend(outputAppend)})
+	}
+	if errorFile != "" {
+		redirs = append(redirs, Redirection{Fd: 2, Target: errorFile, Mode: modeForAppend(errorAppend)})
+	}
+	return m.SetupRedirections(redirs)
+}
+
+// modeForAppend returns the output mode matching an append flag
+func modeForAppend(appendMode bool) RedirectMode {
+	if appendMode {
+		return RedirectAppend
+	}
+	return RedirectTruncate
+}
+
+// SetupRedirections applies the redirections in order and returns a cleanup function.
+// When several redirections target the same descriptor, the last one wins.
+func (m *IOManagerImpl) SetupRedirections(redirs []Redirection) (cleanup func(), err error) {
+	table, opened, err := m.redirect(redirs)
+	if err != nil {
+		return nil, err
+	}
+	m.use(table)
 
 	// Setup cleanup function that will restore original streams
 	cleanup = func() {
-		m.currentStdout = m.originalStdout
-		m.currentStderr = m.originalStderr
-		if outFile != nil {
-			outFile.Close()
+		m.restore()
+		for _, f := range opened {
+			f.Close()
 		}
-		if errFile != nil {
-			errFile.Close()
+	}
+	return cleanup, nil
+}
+
+// SetupPermanentRedirections applies the redirections to the shell's own descriptor
+// table, so that they stay in effect for all later commands. Files no longer
+// referenced by any descriptor are closed.
+func (m *IOManagerImpl) SetupPermanentRedirections(redirs []Redirection) error {
+	table, _, err := m.redirect(redirs)
+	if err != nil {
+		return err
+	}
+
+	for _, old := range m.fds {
+		if old.file != nil && !referencesFile(table, old.file) {
+			old.file.Close()
 		}
 	}
+	m.fds = table
+	m.restore()
+	return nil
+}
 
-	// Setup output redirection
-	if outputFile != "" {
-		var flags int
-		if outputAppend {
-			flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
-		} else {
-			flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+// redirect returns a copy of the shell's descriptor table with the redirections
+// applied, and the files it opened. On error, the opened files are closed.
+func (m *IOManagerImpl) redirect(redirs []Redirection) (table map[int]stream, opened []*os.File, err error) {
+	table = make(map[int]stream, len(m.fds))
+	for fd, s := range m.fds {
+		table[fd] = s
+	}
+
+	fail := func(err error) (map[int]stream, []*os.File, error) {
+		for _, f := range opened {
+			f.Close()
 		}
+		return nil, nil, err
+	}
 
-		outFile, err = os.OpenFile(outputFile, flags, 0644)
-		if err != nil {
-			cleanup()
-			return nil, errors.NewIOError("opening", outputFile, err.Error())
+	for _, r := range redirs {
+		switch r.Mode {
+		case RedirectHeredoc:
+			table[r.Fd] = stream{r: strings.NewReader(r.Target)}
+		case RedirectInput:
+			file, err := os.Open(r.Target)
+			if err != nil {
+				return fail(errors.NewIOError("opening", r.Target, err.Error()))
+			}
+			opened = append(opened, file)
+			table[r.Fd] = stream{r: file, file: file}
+		case RedirectDuplicate:
+			if r.Target == "-" {
+				delete(table, r.Fd)
+				continue
+			}
+			from, err := strconv.Atoi(r.Target)
+			if err != nil {
+				return fail(errors.NewIOError("redirecting", r.Target, "ambiguous redirect"))
+			}
+			s, ok := table[from]
+			if !ok {
+				return fail(badFdError(from))
+			}
+			// Like dup2, a duplicate is inherited even if the original is not
+			s.cloexec = false
+			table[r.Fd] = s
+		default:
+			if m.restricted {
+				return fail(errors.NewRestrictedError(r.Target, "cannot redirect output"))
+			}
+			file, err := m.openOutputFile(r.Target, r.Mode)
+			if err != nil {
+				return fail(err)
+			}
+			opened = append(opened, file)
+			table[r.Fd] = stream{w: file, file: file}
 		}
-		m.currentStdout = outFile
 	}
 
-	// Setup error redirection
-	if errorFile != "" {
-		var flags int
-		if errorAppend {
-			flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
-		} else {
-			flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	return table, opened, nil
+}
+
+// use makes the standard descriptors of a table the current streams
+func (m *IOManagerImpl) use(table map[int]stream) {
+	m.current = table
+	m.currentStdin = table[0].r
+	m.currentStdout = writerFor(table, 1)
+	m.currentStderr = writerFor(table, 2)
+}
+
+// restore makes the shell's own descriptors the current streams again
+func (m *IOManagerImpl) restore() {
+	m.use(m.fds)
+}
+
+// writerFor returns the writer for an output descriptor. Writes to a closed
+// descriptor, or to one only open for reading, fail with EBADF.
+func writerFor(table map[int]stream, fd int) io.Writer {
+	if w := table[fd].w; w != nil {
+		return w
+	}
+	return badFdWriter{}
+}
+
+// badFdWriter is the writer of a descriptor that is not open for writing
+type badFdWriter struct{}
+
+func (badFdWriter) Write(p []byte) (int, error) {
+	return 0, syscall.EBADF
+}
+
+// referencesFile reports whether any descriptor in the table refers to file
+func referencesFile(table map[int]stream, file *os.File) bool {
+	for _, s := range table {
+		if s.file == file {
+			return true
 		}
+	}
+	return false
+}
+
+// openOutputFile opens the target of an output redirection.
+// With noclobber set, '>' refuses to overwrite an existing regular file;
+// O_EXCL makes the existence check and the creation a single atomic step.
+func (m *IOManagerImpl) openOutputFile(path string, mode RedirectMode) (*os.File, error) {
+	var file *os.File
+	var err error
 
-		errFile, err = os.OpenFile(errorFile, flags, 0644)
-		if err != nil {
-			cleanup()
-			return nil, errors.NewIOError("opening", errorFile, err.Error())
+	switch {
+	case mode == RedirectAppend:
+		file, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	case mode == RedirectClobber || !m.noclobber:
+		file, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	default:
+		file, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if os.IsExist(err) {
+			info, statErr := os.Stat(path)
+			if statErr == nil && info.Mode().IsRegular() {
+				return nil, errors.NewIOError("opening", path, "cannot overwrite existing file")
+			}
+			// Devices such as /dev/null may still be written to
+			file, err = os.OpenFile(path, os.O_WRONLY, 0)
 		}
-		m.currentStderr = errFile
 	}
 
-	return cleanup, nil
+	if err != nil {
+		return nil, errors.NewIOError("opening", path, err.Error())
+	}
+	return file, nil
+}
+
+// OpenDescriptor adds an open file to the shell's own descriptor table, for reading
+// or for writing, at the lowest free descriptor not below min, and returns it
+func (m *IOManagerImpl) OpenDescriptor(file *os.File, write bool, min int) int {
+	fd := min
+	for {
+		if _, ok := m.fds[fd]; !ok {
+			break
+		}
+		fd++
+	}
+	if write {
+		m.fds[fd] = stream{w: file, file: file, cloexec: true}
+	} else {
+		m.fds[fd] = stream{r: file, file: file, cloexec: true}
+	}
+	return fd
+}
+
+// ExtraFiles returns the files open at descriptors above 2 in the current table, the
+// one for descriptor fd at index fd-3, as exec.Cmd.ExtraFiles takes them. Descriptors
+// that are closed, are not files, such as here-documents, or are not inherited are nil.
+func (m *IOManagerImpl) ExtraFiles() []*os.File {
+	var files []*os.File
+	for fd, s := range m.current {
+		if fd < 3 || s.file == nil || s.cloexec {
+			continue
+		}
+		for len(files) <= fd-3 {
+			files = append(files, nil)
+		}
+		files[fd-3] = s.file
+	}
+	return files
+}
+
+// Reader returns the reader of a descriptor open for reading in the current table
+func (m *IOManagerImpl) Reader(fd int) (io.Reader, error) {
+	r := m.current[fd].r
+	if r == nil {
+		return nil, badFdError(fd)
+	}
+	return r, nil
+}
+
+// badFdError reports a redirection from a descriptor that is not open
+func badFdError(fd int) error {
+	return errors.NewIOError("redirecting", strconv.Itoa(fd), "bad file descriptor")
 }
 
 // GetCurrentStreams returns the current stdout and stderr streams
 func (m *IOManagerImpl) GetCurrentStreams() (stdout, stderr io.Writer) {
 	return m.currentStdout, m.currentStderr
 }
+
+// GetCurrentStdin returns the redirected standard input, or nil if stdin is not redirected
+func (m *IOManagerImpl) GetCurrentStdin() io.Reader {
+	return m.currentStdin
+}
@@ -0,0 +1,532 @@
+package shell
+
+import (
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/codecrafters-io/shell-starter-go/app/internal/executor"
+)
+
+// JobState describes what a job is currently doing
+type JobState int
+
+// JobRunning is a job whose process is executing, JobStopped one that was
+// stopped (e.g. with Ctrl-Z) and JobDone one that has exited
+const (
+	JobRunning JobState = iota
+	JobStopped
+	JobDone
+)
+
+// Job is a command started in the background with '&', or a foreground command
+// that was stopped. Foreground commands only get a job number once they stop.
+type Job struct {
+	ID      int
+	Pgid    int
+	Pids    []int
+	Command string
+	State   JobState
+	// Status is the process state once the job is done
+	Status syscall.WaitStatus
+	// Usage is the resource usage of the job's process once the job is done
+	Usage syscall.Rusage
+
+	started time.Time
+	// elapsed is the wall time from start until the job finished
+	elapsed time.Duration
+
+	cmd  *exec.Cmd
+	done chan struct{}
+	// stopSignal is the signal that last stopped the job
+	stopSignal syscall.Signal
+	// notified is set once the current state has been reported to the user
+	notified bool
+}
+
+// Done returns a channel that is closed once the job has exited
+func (j *Job) Done() <-chan struct{} {
+	return j.done
+}
+
+// ExitCode returns the exit status of a finished job, using 128+n for a job killed by signal n
+func (j *Job) ExitCode() int {
+	return j.Result().ExitCode
+}
+
+// Result describes how a finished job ended and the resources it used
+func (j *Job) Result() executor.ExecResult {
+	return executor.NewExecResult(j.Status, &j.Usage, j.elapsed)
+}
+
+// statusText describes the job's state as shown by the jobs builtin
+func (j *Job) statusText() string {
+	switch {
+	case j.State == JobRunning:
+		return "Running"
+	case j.State == JobStopped:
+		return "Stopped"
+	case j.Status.Signaled():
+		name := j.Status.Signal().String()
+		return strings.ToUpper(name[:1]) + name[1:]
+	case j.Status.ExitStatus() != 0:
+		return fmt.Sprintf("Exit %d", j.Status.ExitStatus())
+	}
+	return "Done"
+}
+
+// JobTable tracks the shell's background jobs by job number
+type JobTable struct {
+	mu sync.Mutex
+	// changed is signaled whenever a job changes state
+	changed *sync.Cond
+	jobs    []*Job
+	// recent orders jobs from most to least recently started or resumed:
+	// recent[0] is the current job (%+) and recent[1] the previous one (%-)
+	recent []*Job
+}
+
+// NewJobTable creates an empty job table
+func NewJobTable() *JobTable {
+	t := &JobTable{}
+	t.changed = sync.NewCond(&t.mu)
+	return t
+}
+
+// Track begins following the state of a started command without giving it a job number
+func (t *JobTable) Track(cmd *exec.Cmd, command string) *Job {
+	pid := cmd.Process.Pid
+	job := &Job{
+		Pgid:    pid,
+		Pids:    []int{pid},
+		Command: command,
+		State:   JobRunning,
+		cmd:     cmd,
+		started: time.Now(),
+		done:    make(chan struct{}),
+		// A running job needs no notification until it changes state
+		notified: true,
+	}
+
+	go t.wait(job)
+	return job
+}
+
+// Add records a started command as a new background job
+func (t *JobTable) Add(cmd *exec.Cmd, command string) *Job {
+	job := t.Track(cmd, command)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.number(job)
+	return job
+}
+
+// number gives a job the next job number and makes it the current job;
+// the caller must hold t.mu
+func (t *JobTable) number(job *Job) {
+	if job.ID == 0 {
+		job.ID = 1
+		if n := len(t.jobs); n > 0 {
+			job.ID = t.jobs[n-1].ID + 1
+		}
+		t.jobs = append(t.jobs, job)
+	}
+	t.touch(job)
+}
+
+// wait follows the job's process until it exits, recording every stop along the way
+func (t *JobTable) wait(job *Job) {
+	for {
+		status, usage, err := executor.WaitProcess(job.Pids[0])
+
+		t.mu.Lock()
+		if err == nil && status.Stopped() {
+			job.State = JobStopped
+			job.stopSignal = status.StopSignal()
+			job.notified = false
+			t.changed.Broadcast()
+			t.mu.Unlock()
+			continue
+		}
+		job.State = JobDone
+		job.Status = status
+		job.Usage = *usage
+		job.elapsed = time.Since(job.started)
+		job.notified = false
+		t.changed.Broadcast()
+		t.mu.Unlock()
+		break
+	}
+
+	// The process is already reaped, so this only waits for output copying to finish
+	job.cmd.Wait()
+	close(job.done)
+}
+
+// WaitForeground blocks until a job is no longer running and returns its new state.
+// A foreground job that stopped is given a job number so that fg and bg can resume it.
+func (t *JobTable) WaitForeground(job *Job) JobState {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for job.State == JobRunning {
+		t.changed.Wait()
+	}
+	if job.State == JobStopped {
+		t.number(job)
+	}
+	return job.State
+}
+
+// WaitStopped blocks until a job has exited or is stopped and returns its state. For a
+// stopped job, it also returns the signal that stopped it.
+func (t *JobTable) WaitStopped(job *Job) (JobState, syscall.Signal) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for job.State == JobRunning {
+		t.changed.Wait()
+	}
+	return job.State, job.stopSignal
+}
+
+// Continue resumes a stopped job by sending SIGCONT to its process group
+func (t *JobTable) Continue(job *Job) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if job.State != JobStopped {
+		return nil
+	}
+	if err := syscall.Kill(-job.Pgid, syscall.SIGCONT); err != nil {
+		return err
+	}
+	job.State = JobRunning
+	job.notified = true
+	t.touch(job)
+	return nil
+}
+
+// touch makes job the current job; the caller must hold t.mu
+func (t *JobTable) touch(job *Job) {
+	t.forget(job)
+	t.recent = append([]*Job{job}, t.recent...)
+}
+
+// forget removes job from the recency list; the caller must hold t.mu
+func (t *JobTable) forget(job *Job) {
+	for i, j := range t.recent {
+		if j == job {
+			t.recent = append(t.recent[:i], t.recent[i+1:]...)
+			return
+		}
+	}
+}
+
+// Remove deletes a job from the table
+func (t *JobTable) Remove(job *Job) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.remove(job)
+}
+
+// remove deletes a job from the table; the caller must hold t.mu
+func (t *JobTable) remove(job *Job) {
+	t.forget(job)
+	for i, j := range t.jobs {
+		if j == job {
+			t.jobs = append(t.jobs[:i], t.jobs[i+1:]...)
+			return
+		}
+	}
+}
+
+// Jobs returns the jobs in order of job number
+func (t *JobTable) Jobs() []*Job {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]*Job(nil), t.jobs...)
+}
+
+// State returns the current state of a job
+func (t *JobTable) State(job *Job) JobState {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return job.State
+}
+
+// Marker returns '+' for the current job, '-' for the previous one and ' ' otherwise
+func (t *JobTable) Marker(job *Job) byte {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.marker(job)
+}
+
+// marker is Marker for callers that already hold t.mu
+func (t *JobTable) marker(job *Job) byte {
+	switch {
+	case len(t.recent) > 0 && t.recent[0] == job:
+		return '+'
+	case len(t.recent) > 1 && t.recent[1] == job:
+		return '-'
+	}
+	return ' '
+}
+
+// format renders a job as the jobs builtin prints it; the caller must hold t.mu
+func (t *JobTable) format(job *Job, long bool) string {
+	command := job.Command
+	if job.State == JobRunning {
+		command += " &"
+	}
+	if long {
+		return fmt.Sprintf("[%d]%c %d %-24s%s", job.ID, t.marker(job), job.Pgid, job.statusText(), command)
+	}
+	return fmt.Sprintf("[%d]%c  %-24s%s", job.ID, t.marker(job), job.statusText(), command)
+}
+
+// Notify reports the jobs that stopped or finished since the last notification,
+// and removes the finished ones
+func (t *JobTable) Notify(w io.Writer) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, job := range append([]*Job(nil), t.jobs...) {
+		if !job.notified {
+			fmt.Fprintln(w, t.format(job, false))
+			job.notified = true
+		}
+		if job.State == JobDone {
+			t.remove(job)
+		}
+	}
+}
+
+// Find resolves a job spec such as %1, %+, %-, %% or %name to a job.
+// A bare number is treated as a process ID.
+func (t *JobTable) Find(spec string) (*Job, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !strings.HasPrefix(spec, "%") {
+		pid, err := strconv.Atoi(spec)
+		if err != nil {
+			return nil, fmt.Errorf("%s: not a pid or valid job spec", spec)
+		}
+		for _, job := range t.jobs {
+			for _, p := range job.Pids {
+				if p == pid {
+					return job, nil
+				}
+			}
+		}
+		return nil, fmt.Errorf("%s: no such job", spec)
+	}
+
+	switch rest := spec[1:]; {
+	case rest == "" || rest == "%" || rest == "+":
+		if len(t.recent) > 0 {
+			return t.recent[0], nil
+		}
+	case rest == "-":
+		if len(t.recent) > 1 {
+			return t.recent[1], nil
+		}
+	default:
+		if id, err := strconv.Atoi(rest); err == nil {
+			for _, job := range t.jobs {
+				if job.ID == id {
+					return job, nil
+				}
+			}
+			break
+		}
+
+		var matches []*Job
+		for _, job := range t.jobs {
+			if needle, ok := strings.CutPrefix(rest, "?"); ok {
+				if strings.Contains(job.Command, needle) {
+					matches = append(matches, job)
+				}
+			} else if strings.HasPrefix(job.Command, rest) {
+				matches = append(matches, job)
+			}
+		}
+		if len(matches) > 1 {
+			return nil, fmt.Errorf("%s: ambiguous job spec", spec)
+		}
+		if len(matches) == 1 {
+			return matches[0], nil
+		}
+	}
+	return nil, fmt.Errorf("%s: no such job", spec)
+}
+
+// findJob resolves the job spec given to a builtin, defaulting to the current job
+func (s *Shell) findJob(builtin string, args []string) (*Job, error) {
+	spec := "%+"
+	if len(args) > 0 {
+		spec = args[0]
+	}
+	job, err := s.jobs.Find(spec)
+	if err != nil {
+		if len(args) == 0 {
+			return nil, fmt.Errorf("%s: no current job", builtin)
+		}
+		return nil, fmt.Errorf("%s: %s", builtin, err.Error())
+	}
+	return job, nil
+}
+
+// handleJobs handles the 'jobs' built-in command
+func (s *Shell) handleJobs(args []string, stdout, stderr io.Writer) error {
+	long, pidsOnly := false, false
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		for _, flag := range args[0][1:] {
+			switch flag {
+			case 'l':
+				long = true
+			case 'p':
+				pidsOnly = true
+			default:
+				return fmt.Errorf("jobs: -%c: invalid option", flag)
+			}
+		}
+		args = args[1:]
+	}
+
+	jobs := s.jobs.Jobs()
+	if len(args) > 0 {
+		jobs = nil
+		for _, spec := range args {
+			job, err := s.jobs.Find(spec)
+			if err != nil {
+				return fmt.Errorf("jobs: %s", err.Error())
+			}
+			jobs = append(jobs, job)
+		}
+	}
+
+	s.jobs.mu.Lock()
+	defer s.jobs.mu.Unlock()
+	for _, job := range jobs {
+		if pidsOnly {
+			fmt.Fprintln(stdout, job.Pgid)
+			continue
+		}
+		fmt.Fprintln(stdout, s.jobs.format(job, long))
+		job.notified = true
+		if job.State == JobDone {
+			s.jobs.remove(job)
+		}
+	}
+	return nil
+}
+
+// handleFg handles the 'fg' built-in command
+func (s *Shell) handleFg(args []string, stdout, stderr io.Writer) error {
+	job, err := s.findJob("fg", args)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(stdout, job.Command)
+	if s.tty >= 0 {
+		tcsetpgrp(s.tty, job.Pgid)
+	}
+	if err := s.jobs.Continue(job); err != nil {
+		s.reclaimTerminal()
+		return fmt.Errorf("fg: %s", err.Error())
+	}
+	s.waitForeground(job)
+	return nil
+}
+
+// waitForeground waits for a foreground job to finish or stop, takes the terminal
+// back and returns the job's exit status
+func (s *Shell) waitForeground(job *Job) int {
+	state := s.jobs.WaitForeground(job)
+	s.reclaimTerminal()
+
+	if state == JobStopped {
+		// Start the notification on its own line, after the ^Z echoed by the terminal
+		fmt.Fprintln(s.stderr)
+		s.jobs.Notify(s.stderr)
+		return 128 + int(syscall.SIGTSTP)
+	}
+	<-job.Done()
+	s.jobs.Remove(job)
+	result := job.Result()
+	s.lastResult = &result
+
+	// Like other shells, report commands killed by a signal, except for the
+	// usual Ctrl-C where only a newline is needed after the echoed ^C
+	if job.Status.Signaled() {
+		switch sig := job.Status.Signal(); sig {
+		case syscall.SIGINT:
+			fmt.Fprintln(s.stderr)
+			// The terminal sent Ctrl-C to the job only; a trap on INT still applies
+			s.traps.Queue("INT")
+		case syscall.SIGPIPE:
+		default:
+			fmt.Fprintln(s.stderr, job.statusText())
+		}
+	}
+	return job.ExitCode()
+}
+
+// handleBg handles the 'bg' built-in command
+func (s *Shell) handleBg(args []string, stdout, stderr io.Writer) error {
+	job, err := s.findJob("bg", args)
+	if err != nil {
+		return err
+	}
+	if s.jobs.State(job) != JobStopped {
+		return fmt.Errorf("bg: job %d already in background", job.ID)
+	}
+	if err := s.jobs.Continue(job); err != nil {
+		return fmt.Errorf("bg: %s", err.Error())
+	}
+	fmt.Fprintf(stdout, "[%d]%c %s &\n", job.ID, s.jobs.Marker(job), job.Command)
+	return nil
+}
+
+// handleWait handles the 'wait' built-in command: wait for the given jobs or process IDs,
+// or for all jobs when none are given. Its status is that of the last job given. As in
+// bash, a stopped job does not keep wait waiting; its status is 128 plus the stop signal.
+func (s *Shell) handleWait(args []string, stdout, stderr io.Writer) error {
+	if len(args) == 0 {
+		for _, job := range s.jobs.Jobs() {
+			s.waitJob(job)
+		}
+		return nil
+	}
+
+	status := 0
+	for _, spec := range args {
+		job, err := s.jobs.Find(spec)
+		if err != nil {
+			return fmt.Errorf("wait: %s", err.Error())
+		}
+		status = s.waitJob(job)
+	}
+	if status != 0 {
+		return exitStatus(status)
+	}
+	return nil
+}
+
+// waitJob waits until a job has exited or is stopped and returns its status for wait
+func (s *Shell) waitJob(job *Job) int {
+	if state, sig := s.jobs.WaitStopped(job); state == JobStopped {
+		return 128 + int(sig)
+	}
+	<-job.Done()
+	return job.ExitCode()
+}
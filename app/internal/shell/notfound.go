@@ -0,0 +1,102 @@
+package shell
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/codecrafters-io/shell-starter-go/app/internal/errors"
+)
+
+// commandNotFoundHandle is the command run instead of one that does not exist, as in bash.
+// The shell has no functions, so it is found among the builtins, where an embedder can
+// register it.
+const commandNotFoundHandle = "command_not_found_handle"
+
+// maxSuggestions limits how many similar commands are suggested
+const maxSuggestions = 3
+
+// commandNotFound handles a command that is neither a builtin nor found in PATH. It runs
+// command_not_found_handle with the command and its arguments if there is one, and
+// otherwise reports the error with suggestions. It returns the command's exit status.
+func (s *Shell) commandNotFound(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if s.builtins.IsBuiltin(commandNotFoundHandle) {
+		return s.runCommand(commandNotFoundHandle, args, nil, stdin, stdout, stderr)
+	}
+
+	err := errors.NewCommandNotFoundErrorWithSuggestions(args[0], s.suggestCommands(args[0]))
+	fmt.Fprintf(stderr, "%s\n", err.Error())
+	return 127
+}
+
+// suggestCommands returns the builtins and PATH executables closest to name by edit
+// distance, allowing one edit for short names and two for longer ones
+func (s *Shell) suggestCommands(name string) []string {
+	limit := min(2, len(name)/2)
+	if limit == 0 {
+		return nil
+	}
+
+	var candidates []string
+	if registry, ok := s.builtins.(BuiltinRegistryWithNames); ok {
+		candidates = append(candidates, registry.Names()...)
+	}
+	candidates = append(candidates, s.commands.Names()...)
+
+	type suggestion struct {
+		name     string
+		distance int
+	}
+	var suggestions []suggestion
+	seen := make(map[string]bool)
+	for _, candidate := range candidates {
+		if seen[candidate] || candidate == commandNotFoundHandle {
+			continue
+		}
+		seen[candidate] = true
+		if d := editDistance(name, candidate); d <= limit {
+			suggestions = append(suggestions, suggestion{candidate, d})
+		}
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		if suggestions[i].distance != suggestions[j].distance {
+			return suggestions[i].distance < suggestions[j].distance
+		}
+		return suggestions[i].name < suggestions[j].name
+	})
+
+	var names []string
+	for i := 0; i < len(suggestions) && i < maxSuggestions; i++ {
+		names = append(names, suggestions[i].name)
+	}
+	return names
+}
+
+// editDistance returns the number of single-character insertions, deletions,
+// substitutions and transpositions of adjacent characters that turn a into b
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	// prev2, prev and cur are the last three rows of the distance matrix
+	prev2 := make([]int, len(rb)+1)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				cur[j] = min(cur[j], prev2[j-2]+1)
+			}
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+	return prev[len(rb)]
+}
@@ -0,0 +1,161 @@
+package shell
+
+import (
+	"fmt"
+	"io"
+)
+
+// shellOption describes an option that can be changed with the set builtin
+type shellOption struct {
+	// name is the long name used with "set -o name"
+	name string
+	// flag is the single-letter form used with "set -X", or 0 if there is none
+	flag rune
+	// unsupported, if set, is why the option cannot be enabled yet
+	unsupported string
+}
+
+// shellOptions lists the options known to the set builtin, in the order "set -o" lists them.
+// pipefail is listed, and can be turned off, but the shell has no pipelines for it to change.
+var shellOptions = []shellOption{
+	{name: "dryrun"},
+	{name: "errexit", flag: 'e'},
+	{name: "noclobber", flag: 'C'},
+	{name: "nounset", flag: 'u'},
+	{name: "pipefail", unsupported: "not supported, as the shell has no pipelines"},
+	{name: "xtrace", flag: 'x'},
+}
+
+// checkEnabled returns an error if the option is being enabled but cannot be
+func (opt shellOption) checkEnabled(enabled bool) error {
+	if enabled && opt.unsupported != "" {
+		return fmt.Errorf("%s: %s", opt.name, opt.unsupported)
+	}
+	return nil
+}
+
+// lookupOptionFlag returns the option with the given single-letter flag
+func lookupOptionFlag(flag rune) (shellOption, bool) {
+	for _, opt := range shellOptions {
+		if opt.flag != 0 && opt.flag == flag {
+			return opt, true
+		}
+	}
+	return shellOption{}, false
+}
+
+// lookupOptionName returns the option with the given long name
+func lookupOptionName(name string) (shellOption, bool) {
+	for _, opt := range shellOptions {
+		if opt.name == name {
+			return opt, true
+		}
+	}
+	return shellOption{}, false
+}
+
+// option reports whether the named option is enabled
+func (s *Shell) option(name string) bool {
+	return s.options[name]
+}
+
+// setOption enables or disables the named option and applies its side effects
+func (s *Shell) setOption(name string, enabled bool) {
+	if s.options == nil {
+		s.options = make(map[string]bool)
+	}
+	s.options[name] = enabled
+
+	if name == "noclobber" {
+		if ioManager, ok := s.ioManager.(IOManagerWithRedirections); ok {
+			ioManager.SetNoclobber(enabled)
+		}
+	}
+}
+
+// SetOption enables or disables the named option, as "set -o name" does
+func (s *Shell) SetOption(name string, enabled bool) error {
+	opt, ok := lookupOptionName(name)
+	if !ok {
+		return fmt.Errorf("%s: invalid option name", name)
+	}
+	if err := opt.checkEnabled(enabled); err != nil {
+		return err
+	}
+	s.setOption(opt.name, enabled)
+	return nil
+}
+
+// optionFlags returns the single-letter flags of the enabled options, as $- expands to,
+// followed by 'i' for an interactive shell and 'r' for a restricted one
+func (s *Shell) optionFlags() string {
+	var flags []rune
+	for _, opt := range shellOptions {
+		if opt.flag != 0 && s.option(opt.name) {
+			flags = append(flags, opt.flag)
+		}
+	}
+	if s.tty >= 0 {
+		flags = append(flags, 'i')
+	}
+	if s.restricted {
+		flags = append(flags, 'r')
+	}
+	return string(flags)
+}
+
+// printOptions lists every option and its state. With commands set, the list is
+// written as set commands that restore the current state.
+func (s *Shell) printOptions(stdout io.Writer, commands bool) {
+	for _, opt := range shellOptions {
+		enabled := s.option(opt.name)
+		switch {
+		case commands && enabled:
+			fmt.Fprintf(stdout, "set -o %s\n", opt.name)
+		case commands:
+			fmt.Fprintf(stdout, "set +o %s\n", opt.name)
+		case enabled:
+			fmt.Fprintf(stdout, "%-15s\ton\n", opt.name)
+		default:
+			fmt.Fprintf(stdout, "%-15s\toff\n", opt.name)
+		}
+	}
+}
+
+// handleSet handles the 'set' built-in command: "set -C", "set +o noclobber", ...
+// "set -o" and "set +o" without an option name list the options.
+func (s *Shell) handleSet(args []string, stdout, stderr io.Writer) error {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if len(arg) < 2 || (arg[0] != '-' && arg[0] != '+') {
+			return fmt.Errorf("set: %s: invalid option", arg)
+		}
+		enabled := arg[0] == '-'
+
+		if arg[1:] == "o" {
+			if i+1 >= len(args) {
+				s.printOptions(stdout, !enabled)
+				continue
+			}
+			i++
+			opt, ok := lookupOptionName(args[i])
+			if !ok {
+				return fmt.Errorf("set: %s: invalid option name", args[i])
+			}
+			if err := opt.checkEnabled(enabled); err != nil {
+				return fmt.Errorf("set: %s", err.Error())
+			}
+			s.setOption(opt.name, enabled)
+			continue
+		}
+
+		for _, flag := range arg[1:] {
+			opt, ok := lookupOptionFlag(flag)
+			if !ok {
+				return fmt.Errorf("set: %c%c: invalid option", arg[0], flag)
+			}
+			s.setOption(opt.name, enabled)
+		}
+	}
+	return nil
+}
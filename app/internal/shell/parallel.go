@@ -0,0 +1,251 @@
+package shell
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/codecrafters-io/shell-starter-go/app/internal/executor"
+)
+
+// parallelUsage is the error for a parallel command without a command template
+const parallelUsage = "parallel: usage: parallel [-j N] [--halt never|soon,fail=N|now,fail=N] command [args...] [::: items...]"
+
+// parallelHalt says when parallel stops running jobs after failures. With soon,
+// no new jobs are started once failures jobs have failed; with now, the running
+// jobs are killed too. A zero failures never halts.
+type parallelHalt struct {
+	now      bool
+	failures int
+}
+
+// parseHalt parses the argument of --halt
+func parseHalt(value string) (parallelHalt, error) {
+	if value == "never" {
+		return parallelHalt{}, nil
+	}
+	when, condition, _ := strings.Cut(value, ",")
+	count, ok := strings.CutPrefix(condition, "fail=")
+	n, err := strconv.Atoi(count)
+	if (when != "soon" && when != "now") || !ok || err != nil || n < 1 {
+		return parallelHalt{}, fmt.Errorf("parallel: --halt %s: expected never, soon,fail=N or now,fail=N", value)
+	}
+	return parallelHalt{now: when == "now", failures: n}, nil
+}
+
+// parallelJob is one run of the command template and its buffered output
+type parallelJob struct {
+	argv           []string
+	stdout, stderr bytes.Buffer
+	status         int
+	// process is the running process, when the executor can start commands
+	process *os.Process
+	killed  bool
+}
+
+// handleParallel handles the 'parallel' built-in command:
+// "parallel [-j N] [--halt when,fail=N] command [args...] [::: items...]".
+// It runs the command once per item, taken from the arguments after ":::" or else
+// from the lines of standard input, with at most N jobs at a time (default: the
+// number of CPUs, 0 for no limit). In the command, {} is replaced by the item, {.}
+// by the item without its extension and {/} by its base name; without any of them
+// the item is added as the last argument. Each job's output is written in one piece
+// when it finishes. The status is the worst status of the jobs.
+//
+// The commands are run by the executor, so a builtin name runs the program of that
+// name found in PATH.
+func (s *Shell) handleParallel(args []string, stdout, stderr io.Writer) error {
+	limit := runtime.NumCPU()
+	var halt parallelHalt
+	for len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' {
+		arg := args[0]
+		args = args[1:]
+		if arg == "--" {
+			break
+		}
+
+		name, value, hasValue := strings.Cut(arg, "=")
+		if strings.HasPrefix(arg, "-j") && arg != "-j" {
+			name, value, hasValue = "-j", arg[2:], true
+		}
+		if name != "-j" && name != "--jobs" && name != "--halt" {
+			return fmt.Errorf("parallel: %s: invalid option", arg)
+		}
+		if !hasValue {
+			if len(args) == 0 {
+				return fmt.Errorf("parallel: %s: option requires an argument", name)
+			}
+			value, args = args[0], args[1:]
+		}
+
+		if name == "--halt" {
+			var err error
+			if halt, err = parseHalt(value); err != nil {
+				return err
+			}
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return fmt.Errorf("parallel: %s: invalid number of jobs", value)
+		}
+		limit = n
+	}
+
+	template := args
+	var items []string
+	for i, arg := range args {
+		if arg == ":::" {
+			template, items = args[:i], args[i+1:]
+			break
+		}
+	}
+	if len(template) == 0 {
+		return fmt.Errorf("%s", parallelUsage)
+	}
+	if len(template) == len(args) {
+		input, err := s.readInput(-1)
+		if err != nil {
+			return fmt.Errorf("parallel: %s", err.Error())
+		}
+		for {
+			line, eof := readLine(input, true)
+			if line != "" || !eof {
+				items = append(items, line)
+			}
+			if eof {
+				break
+			}
+		}
+	}
+
+	status := s.runParallel(template, items, limit, halt, stdout, stderr)
+	if status != 0 {
+		return exitStatus(status)
+	}
+	return nil
+}
+
+// runParallel runs the jobs for items with at most limit at a time and returns the
+// worst status of the jobs that were not killed
+func (s *Shell) runParallel(template, items []string, limit int, halt parallelHalt, stdout, stderr io.Writer) int {
+	if limit == 0 {
+		limit = len(items)
+	}
+	env := s.vars.Environ(nil)
+	done := make(chan *parallelJob)
+	running := make(map[*parallelJob]bool)
+	next, failures, worst := 0, 0, 0
+	halted := false
+
+	for next < len(items) && !halted || len(running) > 0 {
+		if next < len(items) && !halted && len(running) < limit {
+			job := &parallelJob{argv: expandTemplate(template, items[next])}
+			next++
+			running[job] = true
+			s.startParallelJob(job, env, done)
+			continue
+		}
+
+		// Output is written here, by one goroutine, so jobs never interleave
+		job := <-done
+		delete(running, job)
+		stdout.Write(job.stdout.Bytes())
+		stderr.Write(job.stderr.Bytes())
+		if job.killed {
+			continue
+		}
+		worst = max(worst, job.status)
+		if job.status == 0 {
+			continue
+		}
+
+		failures++
+		if halt.failures == 0 || failures < halt.failures || halted {
+			continue
+		}
+		halted = true
+		if halt.now {
+			fmt.Fprintf(stderr, "parallel: halting, killing %d running jobs\n", len(running))
+			for other := range running {
+				if other.process != nil {
+					other.killed = true
+					// Each command runs in its own process group, see CommandExecutorWithJobs
+					syscall.Kill(-other.process.Pid, syscall.SIGTERM)
+				}
+			}
+		} else if len(running) > 0 {
+			fmt.Fprintf(stderr, "parallel: starting no more jobs, waiting for %d jobs to finish\n", len(running))
+		}
+	}
+	return worst
+}
+
+// startParallelJob runs a job in the background and sends it to done once it has finished
+func (s *Shell) startParallelJob(job *parallelJob, env []string, done chan<- *parallelJob) {
+	// The command name may come from the item, so it is only checked once it is in place
+	if err := s.checkRestricted(nil, job.argv); err != nil {
+		fmt.Fprintf(&job.stderr, "%s\n", err.Error())
+		job.status = 1
+		go func() { done <- job }()
+		return
+	}
+
+	starter, ok := s.executor.(CommandExecutorWithJobs)
+	if !ok {
+		// Without Start the job cannot be killed, so --halt now acts as soon
+		go func() {
+			if runner, ok := s.executor.(CommandExecutorWithEnv); ok {
+				job.status = runner.ExecuteWithEnv(job.argv[0], job.argv[1:], env, nil, &job.stdout, &job.stderr).ExitCode
+			} else {
+				job.status = s.executor.Execute(job.argv[0], job.argv[1:], nil, &job.stdout, &job.stderr).ExitCode
+			}
+			done <- job
+		}()
+		return
+	}
+
+	cmd, err := starter.Start(job.argv[0], job.argv[1:], env, nil, &job.stdout, &job.stderr, -1)
+	if err != nil {
+		fmt.Fprintf(&job.stderr, "%s\n", err.Error())
+		job.status = executor.ExitStatus(err)
+		go func() { done <- job }()
+		return
+	}
+	job.process = cmd.Process
+	go func() {
+		cmd.Wait()
+		status, _ := cmd.ProcessState.Sys().(syscall.WaitStatus)
+		job.status = executor.NewExecResult(status, nil, 0).ExitCode
+		done <- job
+	}()
+}
+
+// expandTemplate replaces the placeholders in the words of a parallel command with
+// an item: {} is the item, {.} the item without its extension and {/} its base name.
+// Without any placeholder, the item is added as the last word.
+func expandTemplate(template []string, item string) []string {
+	replacer := strings.NewReplacer(
+		"{}", item,
+		"{.}", strings.TrimSuffix(item, filepath.Ext(item)),
+		"{/}", filepath.Base(item),
+	)
+	argv := make([]string, 0, len(template)+1)
+	found := false
+	for _, word := range template {
+		if strings.Contains(word, "{}") || strings.Contains(word, "{.}") || strings.Contains(word, "{/}") {
+			found = true
+		}
+		argv = append(argv, replacer.Replace(word))
+	}
+	if !found {
+		argv = append(argv, item)
+	}
+	return argv
+}
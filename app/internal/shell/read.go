@@ -0,0 +1,171 @@
+package shell
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// handleRead handles the 'read' built-in command: "read [-r] [-u fd] [name...]".
+// It reads a line and assigns its fields, split on IFS, to the names in turn, the last
+// name getting the rest of the line. Without names the whole line is assigned to REPLY.
+// Without -r, a backslash escapes the next character and joins lines.
+func (s *Shell) handleRead(args []string, stdout, stderr io.Writer) error {
+	raw := false
+	fd := -1
+	for len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' {
+		arg := args[0]
+		args = args[1:]
+		if arg == "--" {
+			break
+		}
+		for i, c := range arg[1:] {
+			switch c {
+			case 'r':
+				raw = true
+			case 'u':
+				// The descriptor is the rest of the word or the next argument
+				value := arg[2+i:]
+				if value == "" {
+					if len(args) == 0 {
+						return fmt.Errorf("read: -u: option requires an argument")
+					}
+					value, args = args[0], args[1:]
+				}
+				n, err := strconv.Atoi(value)
+				if err != nil || n < 0 {
+					return fmt.Errorf("read: %s: invalid file descriptor specification", value)
+				}
+				fd = n
+			default:
+				return fmt.Errorf("read: -%c: invalid option", c)
+			}
+			if c == 'u' {
+				break
+			}
+		}
+	}
+	for _, name := range args {
+		if !isName(name) {
+			return fmt.Errorf("read: `%s': not a valid identifier", name)
+		}
+	}
+	if err := s.checkRestrictedNames(args...); err != nil {
+		return fmt.Errorf("read: %s", err.Error())
+	}
+
+	input, err := s.readInput(fd)
+	if err != nil {
+		return fmt.Errorf("read: %d: %s", fd, err.Error())
+	}
+	line, eof := readLine(input, raw)
+
+	if len(args) == 0 {
+		if err := s.vars.Set("REPLY", line); err != nil {
+			return fmt.Errorf("read: %s", err.Error())
+		}
+	} else {
+		ifs, ok := s.variable("IFS")
+		if !ok {
+			ifs = defaultIFS
+		}
+		fields := splitRead(line, ifs, len(args))
+		for i, name := range args {
+			value := ""
+			if i < len(fields) {
+				value = fields[i]
+			}
+			if err := s.vars.Set(name, value); err != nil {
+				return fmt.Errorf("read: %s", err.Error())
+			}
+		}
+	}
+
+	// Reaching the end of input before a newline is a failure, even with a partial line
+	if eof {
+		return exitStatus(1)
+	}
+	return nil
+}
+
+// readInput returns the reader for read's input: descriptor fd, or the command's
+// standard input when fd is -1
+func (s *Shell) readInput(fd int) (io.Reader, error) {
+	if fd >= 0 {
+		ioManager, ok := s.ioManager.(IOManagerWithDescriptors)
+		if !ok {
+			return nil, fmt.Errorf("invalid file descriptor")
+		}
+		r, err := ioManager.Reader(fd)
+		if err != nil {
+			return nil, fmt.Errorf("invalid file descriptor: bad file descriptor")
+		}
+		return r, nil
+	}
+	if ioManager, ok := s.ioManager.(IOManagerWithRedirections); ok && ioManager.GetCurrentStdin() != nil {
+		return ioManager.GetCurrentStdin(), nil
+	}
+	// The shell's own input is buffered, so it must be read through the same buffer
+	return s.reader, nil
+}
+
+// readLine reads a line from r without its newline, one byte at a time so that the
+// rest of the input is left for the commands that follow. Unless raw is set, a
+// backslash escapes the next character and a backslash-newline pair is removed.
+// eof reports that the input ended before a newline.
+func readLine(r io.Reader, raw bool) (line string, eof bool) {
+	var sb strings.Builder
+	escaped := false
+	buf := make([]byte, 1)
+	for {
+		if n, err := r.Read(buf); n == 0 {
+			if err != nil {
+				return sb.String(), true
+			}
+			continue
+		}
+		c := buf[0]
+		switch {
+		case escaped:
+			escaped = false
+			if c != '\n' {
+				sb.WriteByte(c)
+			}
+		case c == '\\' && !raw:
+			escaped = true
+		case c == '\n':
+			return sb.String(), false
+		default:
+			sb.WriteByte(c)
+		}
+	}
+}
+
+// splitRead splits a line read by the read builtin into at most n fields. IFS
+// whitespace around fields is removed and other IFS characters each end a field, as
+// in field splitting; the last field is the rest of the line.
+func splitRead(line, ifs string, n int) []string {
+	isIFS := func(r rune) bool { return strings.ContainsRune(ifs, r) }
+	isBlank := func(r rune) bool { return isIFS(r) && strings.ContainsRune(defaultIFS, r) }
+
+	line = strings.TrimFunc(line, isBlank)
+	var fields []string
+	for len(fields) < n-1 && line != "" {
+		i := strings.IndexFunc(line, isIFS)
+		if i < 0 {
+			break
+		}
+		fields = append(fields, line[:i])
+		// A delimiter is blanks around at most one other IFS character
+		line = strings.TrimLeftFunc(line[i:], isBlank)
+		if r, size := utf8.DecodeRuneInString(line); line != "" && isIFS(r) {
+			line = strings.TrimLeftFunc(line[size:], isBlank)
+		}
+	}
+	if line != "" {
+		fields = append(fields, line)
+	}
+	return fields
+}
@@ -0,0 +1,83 @@
+package shell
+
+import (
+	"strings"
+
+	"github.com/codecrafters-io/shell-starter-go/app/internal/errors"
+)
+
+// restrictedVariables may not be changed in restricted mode, since they control
+// which programs the shell runs
+var restrictedVariables = []string{"PATH", "SHELL", "ENV"}
+
+// SetRestricted turns on restricted mode, modeled on rbash: the user cannot change
+// directory, change PATH, SHELL or ENV, run commands named by a path, redirect output
+// to files, replace the shell with exec, or source files named by a path. Restricted
+// mode cannot be turned off again.
+func (s *Shell) SetRestricted() {
+	s.restricted = true
+	if ioManager, ok := s.ioManager.(IOManagerWithRedirections); ok {
+		ioManager.SetRestricted(true)
+	}
+}
+
+// checkRestricted returns an error if restricted mode forbids running a command
+// with the given assignments and arguments
+func (s *Shell) checkRestricted(assigns []assignment, args []string) error {
+	if !s.restricted {
+		return nil
+	}
+	for _, a := range assigns {
+		if err := checkRestrictedVariable(a.name); err != nil {
+			return err
+		}
+	}
+	if len(args) == 0 {
+		return nil
+	}
+
+	command := args[0]
+	switch command {
+	case "cd", "exec":
+		return errors.NewRestrictedError(command, "")
+	case "source", ".":
+		if len(args) > 1 && strings.Contains(args[1], "/") {
+			return errors.NewRestrictedError(command+": "+args[1], "")
+		}
+	case "export", "readonly", "unset":
+		for _, arg := range args[1:] {
+			name, _, _ := strings.Cut(arg, "=")
+			if err := checkRestrictedVariable(name); err != nil {
+				return err
+			}
+		}
+	}
+	if strings.Contains(command, "/") {
+		return errors.NewRestrictedError(command, "cannot specify `/' in command names")
+	}
+	return nil
+}
+
+// checkRestrictedNames returns an error if restricted mode forbids assigning any of the
+// named variables, for builtins such as read that assign the variables they are given
+func (s *Shell) checkRestrictedNames(names ...string) error {
+	if !s.restricted {
+		return nil
+	}
+	for _, name := range names {
+		if err := checkRestrictedVariable(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkRestrictedVariable returns an error if name may not be changed in restricted mode
+func checkRestrictedVariable(name string) error {
+	for _, v := range restrictedVariables {
+		if name == v {
+			return errors.NewRestrictedError(name, "cannot modify variable")
+		}
+	}
+	return nil
+}
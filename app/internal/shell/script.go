@@ -0,0 +1,270 @@
+package shell
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/codecrafters-io/shell-starter-go/app/internal/executor"
+	"github.com/codecrafters-io/shell-starter-go/app/syntax"
+)
+
+// executeScript parses source text into a syntax tree and runs its statements in order
+func (s *Shell) executeScript(p ScriptParser, ioManager IOManagerWithRedirections, src string) {
+	file, err := p.Parse(src, "")
+	if err != nil {
+		fmt.Fprintf(s.stderr, "%s\n", err.Error())
+		s.lastStatus = 2
+		return
+	}
+
+	s.depth++
+	defer func() { s.depth-- }()
+	for _, stmt := range file.Stmts {
+		if s.audit != nil {
+			s.auditLine = statementText(src, stmt)
+		}
+		s.runTrap("DEBUG")
+		if err := s.checkUnbound(stmt); err != nil {
+			fmt.Fprintf(s.stderr, "%s\n", err.Error())
+			// Only an interactive shell survives an expansion error
+			if s.tty < 0 {
+				s.exit(1)
+				return
+			}
+			s.lastStatus = 1
+		} else if stmt.Time != nil {
+			s.lastStatus = s.timeStmt(stmt, ioManager)
+		} else {
+			s.lastStatus = s.executeStmt(stmt, ioManager)
+		}
+		if s.lastStatus != 0 {
+			s.runTrap("ERR")
+			// The shell has no if, &&, || or !, so every failing statement is subject to errexit
+			if s.option("errexit") {
+				s.exit(s.lastStatus)
+				return
+			}
+		}
+		s.runPendingTraps()
+	}
+}
+
+// executeStmt runs a single statement with its redirections applied and returns its exit status
+func (s *Shell) executeStmt(stmt *syntax.Stmt, ioManager IOManagerWithRedirections) (status int) {
+	assigns, words := s.expandAssignments(stmt.Cmd.Args)
+	args := make([]string, 0, len(words))
+	for _, word := range words {
+		args = append(args, s.expandFields(word)...)
+	}
+	coprocName := ""
+	if stmt.Coproc != nil {
+		coprocName, args = s.coprocName(args)
+		if len(args) == 0 {
+			fmt.Fprintf(s.stderr, "coproc: missing command\n")
+			return 2
+		}
+	}
+
+	redirs := make([]Redirection, 0, len(stmt.Redirs))
+	for _, r := range stmt.Redirs {
+		redirs = append(redirs, s.redirection(r))
+	}
+
+	var record *auditRecord
+	if s.audit != nil && len(args) > 0 {
+		record = s.startAudit(args, redirs, stmt.Background)
+		saved := s.auditing
+		s.auditing = record
+		defer func() {
+			s.auditing = saved
+			s.auditCommand(record, status)
+		}()
+	}
+
+	if err := s.checkRestricted(assigns, args); err != nil {
+		fmt.Fprintf(s.stderr, "%s\n", err.Error())
+		return 1
+	}
+
+	// The trace goes to the shell's standard error, not the command's
+	_, shellStderr := ioManager.GetCurrentStreams()
+	s.traceCommand(shellStderr, assigns, args)
+
+	if s.skipsDryRun(args, redirs) {
+		shellStdout, _ := ioManager.GetCurrentStreams()
+		s.describeDryRun(shellStdout, assigns, args, redirs, stmt.Background)
+		if record != nil {
+			record.dryRun = true
+		}
+		return 0
+	}
+
+	// "exec" without a command applies its redirections to the shell itself
+	if len(args) == 1 && args[0] == "exec" && s.builtins.IsBuiltin("exec") {
+		if err := ioManager.SetupPermanentRedirections(redirs); err != nil {
+			fmt.Fprintf(s.stderr, "%s\n", err.Error())
+			return 1
+		}
+		return 0
+	}
+
+	// Redirections are applied even without a command, so "> file" creates file
+	cleanup, err := ioManager.SetupRedirections(redirs)
+	if err != nil {
+		fmt.Fprintf(s.stderr, "%s\n", err.Error())
+		return 1
+	}
+	defer cleanup()
+	defer s.shareDescriptors(ioManager)()
+
+	if len(args) == 0 {
+		// Assignments without a command set shell variables
+		if err := s.assign(assigns); err != nil {
+			fmt.Fprintf(s.stderr, "%s\n", err.Error())
+			return 1
+		}
+		return 0
+	}
+
+	stdin := s.stdin
+	redirectedStdin := ioManager.GetCurrentStdin()
+	if redirectedStdin != nil {
+		stdin = redirectedStdin
+	}
+	currentStdout, currentStderr := ioManager.GetCurrentStreams()
+
+	if stmt.Coproc != nil {
+		return s.startCoproc(stmt, coprocName, args, s.vars.Environ(assigns), currentStderr)
+	}
+
+	// Builtins finish immediately, so they always run in the foreground, and
+	// see the command's assignments as shell variables for their duration
+	if s.builtins.IsBuiltin(args[0]) {
+		return s.withAssignments(assigns, func() int {
+			return s.runCommand(args[0], args[1:], nil, stdin, currentStdout, currentStderr)
+		})
+	}
+
+	if !strings.Contains(args[0], "/") && s.findCommand(args[0]) == "" {
+		return s.commandNotFound(args, stdin, currentStdout, currentStderr)
+	}
+
+	env := s.vars.Environ(assigns)
+	if starter, ok := s.executor.(CommandExecutorWithJobs); ok {
+		if stmt.Background {
+			// Without job control nothing would stop a background job reading the
+			// shell's input, so like a non-interactive shell give it an empty stdin
+			if redirectedStdin == nil && s.tty < 0 {
+				stdin = nil
+			}
+			return s.startJob(starter, stmt, args, env, stdin, currentStdout, currentStderr)
+		}
+		if s.tty >= 0 {
+			return s.runForegroundJob(starter, stmt, args, env, stdin, currentStdout, currentStderr)
+		}
+	}
+
+	return s.runCommand(args[0], args[1:], env, stdin, currentStdout, currentStderr)
+}
+
+// findCommand finds the path of a command about to run. A hashed command is
+// searched for once, and remembered for the executor to run it from.
+func (s *Shell) findCommand(name string) string {
+	if s.hash != nil {
+		return s.hash.Find(name)
+	}
+	return s.executor.FindCommand(name)
+}
+
+// shareDescriptors makes the executor pass the descriptors above 2 in effect for a
+// command to the programs it starts, and returns a function that passes the ones in
+// effect before again, once the command's redirections are undone
+func (s *Shell) shareDescriptors(ioManager IOManagerWithRedirections) (restore func()) {
+	runner, ok := s.executor.(CommandExecutorWithFiles)
+	fds, ok2 := ioManager.(IOManagerWithDescriptors)
+	if !ok || !ok2 {
+		return func() {}
+	}
+	saved := s.extraFiles
+	s.extraFiles = fds.ExtraFiles()
+	runner.SetExtraFiles(s.extraFiles)
+	return func() {
+		s.extraFiles = saved
+		runner.SetExtraFiles(saved)
+	}
+}
+
+// startJob starts an external command in the background and records it in the job table
+func (s *Shell) startJob(starter CommandExecutorWithJobs, stmt *syntax.Stmt, args, env []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	cmd, err := starter.Start(args[0], args[1:], env, stdin, stdout, stderr, -1)
+	if err != nil {
+		fmt.Fprintf(stderr, "%s\n", err.Error())
+		return executor.ExitStatus(err)
+	}
+
+	job := s.jobs.Add(cmd, commandText(stmt))
+	fmt.Fprintf(s.stderr, "[%d] %d\n", job.ID, job.Pgid)
+	return 0
+}
+
+// runForegroundJob runs an external command in its own process group in the
+// terminal's foreground, so Ctrl-C and Ctrl-Z reach it instead of the shell
+func (s *Shell) runForegroundJob(starter CommandExecutorWithJobs, stmt *syntax.Stmt, args, env []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	cmd, err := starter.Start(args[0], args[1:], env, stdin, stdout, stderr, s.tty)
+	if err != nil {
+		fmt.Fprintf(stderr, "%s\n", err.Error())
+		return executor.ExitStatus(err)
+	}
+
+	return s.waitForeground(s.jobs.Track(cmd, commandText(stmt)))
+}
+
+// commandText renders a statement on a single line, without comments or a trailing '&'
+func commandText(stmt *syntax.Stmt) string {
+	bare := *stmt
+	bare.Comments = nil
+	bare.Trailing = nil
+	bare.Background = false
+
+	var sb strings.Builder
+	syntax.Print(&sb, &syntax.File{Stmts: []*syntax.Stmt{&bare}})
+	line, _, _ := strings.Cut(sb.String(), "\n")
+	return line
+}
+
+// redirection converts a redirection from the syntax tree into one the IOManager can apply
+func (s *Shell) redirection(r *syntax.Redirect) Redirection {
+	redir := Redirection{Fd: r.Fd()}
+
+	switch r.Op {
+	case syntax.AppOut:
+		redir.Mode = RedirectAppend
+	case syntax.ClbOut:
+		redir.Mode = RedirectClobber
+	case syntax.RdrIn:
+		redir.Mode = RedirectInput
+	case syntax.DplOut, syntax.DplIn:
+		redir.Mode = RedirectDuplicate
+		redir.Input = r.Op == syntax.DplIn
+	case syntax.Hdoc, syntax.DashHdoc:
+		redir.Mode = RedirectHeredoc
+		redir.Target = r.Hdoc
+		if r.Op == syntax.DashHdoc {
+			lines := strings.SplitAfter(r.Hdoc, "\n")
+			for i, line := range lines {
+				lines[i] = strings.TrimLeft(line, "\t")
+			}
+			redir.Target = strings.Join(lines, "")
+		}
+		if !quotedWord(r.Word) {
+			redir.Target = s.expandHeredoc(redir.Target)
+		}
+		return redir
+	default:
+		redir.Mode = RedirectTruncate
+	}
+
+	redir.Target = s.expandWord(r.Word)
+	return redir
+}
@@ -6,13 +6,21 @@ import (
 	"io"
 	"os"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 
 	"github.com/codecrafters-io/shell-starter-go/app/internal/builtins"
 	"github.com/codecrafters-io/shell-starter-go/app/internal/errors"
 	"github.com/codecrafters-io/shell-starter-go/app/internal/executor"
+	"github.com/codecrafters-io/shell-starter-go/app/internal/lineedit"
 	"github.com/codecrafters-io/shell-starter-go/app/internal/parser"
+	"github.com/codecrafters-io/shell-starter-go/app/syntax"
 )
 
+// continuationPrompt is shown for the lines of a here-document typed at the prompt
+const continuationPrompt = "> "
+
 // Shell represents the shell program state and behavior
 type Shell struct {
 	reader    *bufio.Reader
@@ -24,22 +32,85 @@ type Shell struct {
 	ioManager IOManager
 	executor  CommandExecutor
 	parser    CommandParser
+	options   map[string]bool
+	jobs      *JobTable
+	vars      *VarTable
+	// environ is the environment the shell started with
+	environ []string
+	// audit records executed commands, if set; auditLine is the text of the statement
+	// being executed and auditing the record of its command
+	audit     *AuditLog
+	auditLine string
+	auditing  *auditRecord
+	// restricted is set in restricted mode, see SetRestricted
+	restricted bool
+	// depth counts the command lines being executed, which nest when a trap action runs
+	depth int
+	// commands lists the executables in PATH, for suggestions
+	commands *executor.CommandIndex
+	// hash is the executor's table of remembered command paths, or nil if it has none
+	hash *executor.HashTable
+	// extraFiles are the descriptors above 2 the executor passes to commands
+	extraFiles []*os.File
+	// tty is the terminal used for job control, or -1 when the shell is not interactive
+	tty  int
+	pgid int
+	// atPrompt is set while the shell waits for the user to type a command
+	atPrompt atomic.Bool
+	// editor reads command lines with editing when the input is a terminal, or is nil
+	editor *lineedit.Editor
+	// compSpecs are the completion specifications defined with complete, by command name
+	compSpecs map[string]*compSpec
+	// lastStatus is the exit status of the most recently executed command
+	lastStatus int
+	// lastResult is how the last external command the shell waited for ended, with
+	// the resources it used, which time reports
+	lastResult  *executor.ExecResult
+	traps       *TrapTable
+	inTrap      bool
+	signals     chan os.Signal
+	signalsOnce sync.Once
+	// exitFunc terminates the process; tests replace it
+	exitFunc func(code int)
 }
 
 // NewShell creates a new shell instance with default configuration
 func NewShell() *Shell {
+	// Scripts without a "#!" line are run by this shell, like other shells do
+	runner := executor.NewService()
+	if self, err := os.Executable(); err == nil {
+		runner.SetScriptInterpreter(self)
+	}
+	return newProcessShell(runner)
+}
+
+// NewSandboxedShell creates a shell that runs every external command in a sandbox
+// where only the given host paths and the current directory are visible, read-only
+func NewSandboxedShell(mounts []string) (*Shell, error) {
+	runner, err := executor.NewSandboxService(mounts)
+	if err != nil {
+		return nil, err
+	}
+	return newProcessShell(runner), nil
+}
+
+// newProcessShell creates a shell that uses the process's standard streams and environment
+func newProcessShell(runner CommandExecutor) *Shell {
 	stdout := os.Stdout
 	stderr := os.Stderr
 
-	return NewShellWithDependencies(
+	s := NewShellWithDependencies(
 		os.Stdin,
 		stdout,
 		stderr,
 		parser.NewService(),
-		executor.NewService(),
+		runner,
 		builtins.NewRegistry(stdout, stderr),
 		NewIOManager(stdout, stderr),
 	)
+	// The shell owns its process, so the process environment follows its exported variables
+	s.vars.syncProcess = true
+	return s
 }
 
 // NewShellWithDependencies creates a new shell instance with provided dependencies
@@ -47,10 +118,11 @@ func NewShellWithDependencies(
 	stdin io.Reader,
 	stdout, stderr io.Writer,
 	parser CommandParser,
-	executor CommandExecutor,
+	runner CommandExecutor,
 	builtins BuiltinRegistry,
 	ioManager IOManager,
 ) *Shell {
+	environ := os.Environ()
 	s := &Shell{
 		stdin:     stdin,
 		stdout:    stdout,
@@ -58,27 +130,107 @@ func NewShellWithDependencies(
 		prompt:    "$ ",
 		builtins:  builtins,
 		ioManager: ioManager,
-		executor:  executor,
+		executor:  runner,
 		parser:    parser,
+		options:   make(map[string]bool),
+		jobs:      NewJobTable(),
+		tty:       terminalFd(stdin),
+		traps:     NewTrapTable(),
+		commands:  executor.NewCommandIndex(),
+		compSpecs: make(map[string]*compSpec),
+		vars:      NewVarTable(environ),
+		environ:   environ,
+		exitFunc:  os.Exit,
 	}
 	s.reader = bufio.NewReader(s.stdin)
 
 	// Configure the command finder for builtins
-	builtins.SetCommandFinder(executor.FindCommand)
+	builtins.SetCommandFinder(runner.FindCommand)
+	if registry, ok := builtins.(BuiltinRegistryWithExit); ok {
+		registry.SetExitHandler(s.exit)
+	}
+	s.registerBuiltins()
+
+	// Commands are searched in the shell's PATH, which is only the process's
+	// when the shell owns its process
+	path, _ := s.vars.Get("PATH")
+	s.setPath(path)
+	s.vars.pathChanged = s.setPath
 
 	return s
 }
 
+// setPath makes the lookups of command names use a new value of PATH
+func (s *Shell) setPath(path string) {
+	s.commands.SetPath(path)
+	if s.hash != nil {
+		s.hash.SetPath(path)
+	}
+}
+
+// registerBuiltins registers the built-in commands that need access to shell state
+func (s *Shell) registerBuiltins() {
+	s.builtins.Register("set", s.handleSet)
+	s.builtins.Register("jobs", s.handleJobs)
+	s.builtins.Register("fg", s.handleFg)
+	s.builtins.Register("bg", s.handleBg)
+	s.builtins.Register("wait", s.handleWait)
+	s.builtins.Register("trap", s.handleTrap)
+	s.builtins.Register("exec", s.handleExec)
+	s.builtins.Register("export", s.handleExport)
+	s.builtins.Register("readonly", s.handleReadonly)
+	s.builtins.Register("unset", s.handleUnset)
+	s.builtins.Register("read", s.handleRead)
+	s.builtins.Register("parallel", s.handleParallel)
+	s.builtins.Register("complete", s.handleComplete)
+	s.builtins.Register("compgen", s.handleCompgen)
+
+	if hasher, ok := s.executor.(CommandExecutorWithHash); ok {
+		s.hash = hasher.CommandHash()
+		s.builtins.Register("hash", s.handleHash)
+		if registry, ok := s.builtins.(BuiltinRegistryWithHash); ok {
+			registry.SetHashLookup(s.hash.Get)
+		}
+	}
+}
+
 // IsBuiltin checks if a command is a built-in command
 func (s *Shell) IsBuiltin(cmd string) bool {
 	return s.builtins.IsBuiltin(cmd)
 }
 
-// Execute executes a single command line
+// Execute executes a single command line, or a script. With a ScriptParser and an
+// IOManagerWithRedirections, as the default dependencies provide, it executes the
+// syntax tree: statements separated by ';', newlines or '&', all redirection operators
+// and here-documents. Otherwise it falls back to the flat ParseLine result, which
+// knows only '>', '>>' and '2>' and runs a single command. Neither has pipelines.
 func (s *Shell) Execute(inputLine string) {
+	if s.audit != nil {
+		// Trap actions run while another line executes
+		saved := s.auditLine
+		s.auditLine = inputLine
+		defer func() { s.auditLine = saved }()
+	}
+
+	// Prefer executing the syntax tree when both the parser and the IOManager support it
+	if scriptParser, ok := s.parser.(ScriptParser); ok {
+		if ioManager, ok := s.ioManager.(IOManagerWithRedirections); ok {
+			s.executeScript(scriptParser, ioManager, inputLine)
+			return
+		}
+	}
+
 	// Try to use the new append-aware parser if available
 	if parserWithMode, ok := s.parser.(CommandParserWithMode); ok {
-		args, outputFile, errorFile, outputAppend, errorAppend, err := parserWithMode.ParseLineWithMode(inputLine)
+		var args []string
+		var outputFile, errorFile string
+		var outputAppend, errorAppend, clobber bool
+		var err error
+		if parserWithClobber, ok := s.parser.(CommandParserWithClobber); ok {
+			args, outputFile, errorFile, outputAppend, errorAppend, clobber, err = parserWithClobber.ParseLineWithClobber(inputLine)
+		} else {
+			args, outputFile, errorFile, outputAppend, errorAppend, err = parserWithMode.ParseLineWithMode(inputLine)
+		}
 
 		if err != nil {
 			fmt.Fprintf(s.stderr, "%s\n", err.Error())
@@ -88,9 +240,26 @@ func (s *Shell) Execute(inputLine string) {
 		if len(args) == 0 {
 			return // Empty command, nothing to do
 		}
+		if err := s.checkRestricted(nil, args); err != nil {
+			fmt.Fprintf(s.stderr, "%s\n", err.Error())
+			s.lastStatus = 1
+			return
+		}
 
-		// Setup redirection using IOManager with append mode support
-		if ioManagerWithMode, ok := s.ioManager.(IOManagerWithMode); ok {
+		// Setup redirection using IOManager with append mode support. Only an IOManager
+		// with redirection lists knows noclobber, and so what '>|' overrides.
+		if ioManager, ok := s.ioManager.(IOManagerWithRedirections); ok && clobber {
+			redir := Redirection{Fd: 1, Target: outputFile, Mode: RedirectClobber}
+			if errorFile != "" {
+				redir = Redirection{Fd: 2, Target: errorFile, Mode: RedirectClobber}
+			}
+			cleanup, err := ioManager.SetupRedirections([]Redirection{redir})
+			if err != nil {
+				fmt.Fprintf(s.stderr, "%s\n", err.Error())
+				return
+			}
+			defer cleanup()
+		} else if ioManagerWithMode, ok := s.ioManager.(IOManagerWithMode); ok {
 			cleanup, err := ioManagerWithMode.SetupRedirectionWithMode(outputFile, errorFile, outputAppend, errorAppend)
 			if err != nil {
 				fmt.Fprintf(s.stderr, "%s\n", err.Error())
@@ -114,15 +283,7 @@ func (s *Shell) Execute(inputLine string) {
 		command := args[0]
 		cmdArgs := args[1:]
 
-		// Execute command
-		if s.builtins.IsBuiltin(command) {
-			err := s.builtins.Execute(command, cmdArgs, currentStdout, currentStderr)
-			if err != nil {
-				fmt.Fprintf(currentStderr, "%s\n", err.Error())
-			}
-		} else {
-			s.executor.Execute(command, cmdArgs, s.stdin, currentStdout, currentStderr)
-		}
+		s.lastStatus = s.runCommand(command, cmdArgs, s.vars.Environ(nil), s.stdin, currentStdout, currentStderr)
 	} else {
 		// Fallback to original parsing (no append support)
 		args, outputFile, errorFile, err := s.parser.ParseLine(inputLine)
@@ -135,6 +296,11 @@ func (s *Shell) Execute(inputLine string) {
 		if len(args) == 0 {
 			return // Empty command, nothing to do
 		}
+		if err := s.checkRestricted(nil, args); err != nil {
+			fmt.Fprintf(s.stderr, "%s\n", err.Error())
+			s.lastStatus = 1
+			return
+		}
 
 		// Setup redirection using IOManager
 		cleanup, err := s.ioManager.SetupRedirection(outputFile, errorFile)
@@ -151,37 +317,128 @@ func (s *Shell) Execute(inputLine string) {
 		command := args[0]
 		cmdArgs := args[1:]
 
-		// Execute command
-		if s.builtins.IsBuiltin(command) {
-			err := s.builtins.Execute(command, cmdArgs, currentStdout, currentStderr)
-			if err != nil {
-				fmt.Fprintf(currentStderr, "%s\n", err.Error())
-			}
-		} else {
-			s.executor.Execute(command, cmdArgs, s.stdin, currentStdout, currentStderr)
+		s.lastStatus = s.runCommand(command, cmdArgs, s.vars.Environ(nil), s.stdin, currentStdout, currentStderr)
+	}
+}
+
+// runCommand runs a builtin or external command with the given streams and returns its exit status.
+// External commands get env as their environment.
+func (s *Shell) runCommand(command string, args, env []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if s.builtins.IsBuiltin(command) {
+		err := s.builtins.Execute(command, args, stdout, stderr)
+		if status, ok := err.(exitStatus); ok {
+			return int(status)
 		}
+		if err != nil {
+			fmt.Fprintf(stderr, "%s\n", err.Error())
+			return 1
+		}
+		return 0
+	}
+	var result executor.ExecResult
+	if runner, ok := s.executor.(CommandExecutorWithEnv); ok {
+		result = runner.ExecuteWithEnv(command, args, env, stdin, stdout, stderr)
+	} else {
+		result = s.executor.Execute(command, args, stdin, stdout, stderr)
+	}
+	s.lastResult = &result
+	return result.ExitCode
+}
+
+// readCommandLine shows the prompt and reads the next command line, through the
+// line editor if there is one. While the line holds a here-document whose body has
+// not ended, it reads the following lines as well, after the continuation prompt.
+func (s *Shell) readCommandLine() (string, error) {
+	input, err := s.readLine(s.prompt)
+	for err == nil && s.heredocPending(input) {
+		var line string
+		line, err = s.readLine(continuationPrompt)
+		if err == io.EOF {
+			// Execute reports the here-document that end of input cut short
+			return input, nil
+		}
+		input += "\n" + line
+	}
+	return input, err
+}
+
+// readLine shows a prompt and reads a line without its newline
+func (s *Shell) readLine(prompt string) (string, error) {
+	if s.editor != nil {
+		return s.editor.ReadLine(prompt)
+	}
+
+	fmt.Fprint(s.stdout, prompt)
+	s.atPrompt.Store(true)
+	defer s.atPrompt.Store(false)
+	line, err := s.reader.ReadString('\n')
+	return strings.TrimSuffix(line, "\n"), err
+}
+
+// heredocPending reports whether input ends inside a here-document, so that the
+// lines after it are the here-document's body
+func (s *Shell) heredocPending(input string) bool {
+	parser, ok := s.parser.(ScriptParser)
+	if !ok {
+		return false
 	}
+	_, err := parser.Parse(input, "")
+	parseErr, ok := err.(syntax.ParseError)
+	return ok && parseErr.Incomplete
+}
+
+// exitStatus is returned by a builtin that fails with a status of its own and
+// without a message, such as read at end of input or wait for a failed job
+type exitStatus int
+
+func (e exitStatus) Error() string {
+	return fmt.Sprintf("exit status %d", int(e))
+}
+
+// RunFile executes a script file and exits with the status of its last command
+func (s *Shell) RunFile(path string) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		ioErr := errors.NewIOError("reading", path, err.Error())
+		fmt.Fprintf(s.stderr, "%s\n", ioErr.Error())
+		s.exitFunc(127)
+		return
+	}
+
+	s.Execute(string(src))
+	s.exit(s.lastStatus)
 }
 
 // Run starts the shell's read-eval-print loop
 func (s *Shell) Run() {
+	if s.tty >= 0 {
+		s.initJobControl()
+		if file, ok := s.stdin.(*os.File); ok && lineedit.Supported(file) {
+			s.editor = lineedit.New(file, s.stdout)
+			s.editor.SetCompleter(s.completeLine)
+		}
+	}
+
 	for {
-		fmt.Fprint(s.stdout, s.prompt)
-		inputLine, err := s.reader.ReadString('\n')
+		s.runPendingTraps()
+		s.jobs.Notify(s.stderr)
+		inputLine, err := s.readCommandLine()
 
+		if err == lineedit.ErrInterrupted {
+			// Ctrl-C abandons the line, as for a command killed by SIGINT
+			s.lastStatus = 128 + int(syscall.SIGINT)
+			continue
+		}
 		if err != nil {
 			if err.Error() == "EOF" {
 				fmt.Fprintln(s.stdout, "exit")
-				os.Exit(0)
+				s.exit(s.lastStatus)
 			}
 			ioErr := errors.NewIOError("reading", "command", err.Error())
 			fmt.Fprintf(s.stderr, "%s\n", ioErr.Error())
 			continue
 		}
 
-		// Trim trailing newline for consistent parsing
-		inputLine = strings.TrimSuffix(inputLine, "\n")
-
 		s.Execute(inputLine)
 	}
 }
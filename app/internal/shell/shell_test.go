@@ -3,12 +3,22 @@ package shell
 import (
 	"bufio"
 	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
 	"strings"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/codecrafters-io/shell-starter-go/app/internal/builtins"
 	"github.com/codecrafters-io/shell-starter-go/app/internal/executor"
+	"github.com/codecrafters-io/shell-starter-go/app/internal/lineedit"
 	"github.com/codecrafters-io/shell-starter-go/app/internal/parser"
 )
 
@@ -18,16 +28,15 @@ func testShell() (*Shell, *bytes.Buffer, *bytes.Buffer, *bytes.Buffer) {
 	outBuf := new(bytes.Buffer)
 	errBuf := new(bytes.Buffer)
 
-	shell := &Shell{
-		stdin:     inBuf,
-		stdout:    outBuf,
-		stderr:    errBuf,
-		prompt:    "$ ",
-		builtins:  builtins.NewRegistry(outBuf, errBuf),
-		ioManager: NewIOManager(outBuf, errBuf),
-		executor:  executor.NewService(),
-		parser:    parser.NewService(),
-	}
+	shell := NewShellWithDependencies(
+		inBuf,
+		outBuf,
+		errBuf,
+		parser.NewService(),
+		executor.NewService(),
+		builtins.NewRegistry(outBuf, errBuf),
+		NewIOManager(outBuf, errBuf),
+	)
 	shell.reader = bufio.NewReader(strings.NewReader(""))
 
 	// Configure with a mock command finder that finds nothing
@@ -127,3 +136,1241 @@ func TestShellExecuteEmptyCommand(t *testing.T) {
 		t.Errorf("Expected no errors for empty command, but got: %q", errBuf.String())
 	}
 }
+
+func TestShellNoclobber(t *testing.T) {
+	shell, _, _, errBuf := testShell()
+	target := filepath.Join(t.TempDir(), "out.txt")
+
+	shell.Execute("echo first > " + target)
+	shell.Execute("set -C")
+	shell.Execute("echo second > " + target)
+
+	if !strings.Contains(errBuf.String(), "cannot overwrite existing file") {
+		t.Errorf("Expected noclobber error, but got: %q", errBuf.String())
+	}
+	if content, _ := os.ReadFile(target); string(content) != "first\n" {
+		t.Errorf("Expected file to be left untouched, but got %q", string(content))
+	}
+
+	errBuf.Reset()
+	shell.Execute("echo third >| " + target)
+	shell.Execute("echo fourth >> " + target)
+	if errBuf.String() != "" {
+		t.Errorf("Expected no errors, but got: %q", errBuf.String())
+	}
+	if content, _ := os.ReadFile(target); string(content) != "third\nfourth\n" {
+		t.Errorf("Expected '>|' to override noclobber, but got %q", string(content))
+	}
+
+	shell.Execute("set +o noclobber")
+	shell.Execute("echo fifth > " + target)
+	if content, _ := os.ReadFile(target); string(content) != "fifth\n" {
+		t.Errorf("Expected '>' to truncate after set +o noclobber, but got %q", string(content))
+	}
+}
+
+// lineParser hides the Parse method of the parser, so that the shell falls back to
+// executing the flat ParseLine result
+type lineParser struct {
+	CommandParserWithClobber
+}
+
+func TestShellExecuteSyntaxTree(t *testing.T) {
+	shell, _, outBuf, errBuf := testShell()
+
+	shell.Execute("echo one; echo two\ncat <<EOF\nbody $?\nEOF\necho three >&2")
+	if outBuf.String() != "one\ntwo\nbody 0\n" {
+		t.Errorf("Expected statements and here-document to run, but got %q", outBuf.String())
+	}
+	if errBuf.String() != "three\n" {
+		t.Errorf("Expected descriptor duplication to reach stderr, but got %q", errBuf.String())
+	}
+
+	outBuf.Reset()
+	errBuf.Reset()
+	shell.Execute("echo a | cat")
+	if outBuf.String() != "" || errBuf.String() != "parse error: 1:8: unsupported operator \"|\"\n" {
+		t.Errorf("Expected pipelines to be rejected, but got %q and %q", outBuf.String(), errBuf.String())
+	}
+}
+
+func TestShellExecuteLineParser(t *testing.T) {
+	shell, _, outBuf, errBuf := testShell()
+	shell.parser = lineParser{parser.NewService()}
+	target := filepath.Join(t.TempDir(), "out.txt")
+
+	shell.Execute("echo one; echo two")
+	if outBuf.String() != "one; echo two\n" {
+		t.Errorf("Expected a single command without a syntax tree, but got %q", outBuf.String())
+	}
+
+	shell.Execute("echo first > " + target)
+	shell.Execute("set -C")
+	shell.Execute("echo second > " + target)
+	if !strings.Contains(errBuf.String(), "cannot overwrite existing file") {
+		t.Errorf("Expected noclobber error, but got: %q", errBuf.String())
+	}
+	if content, _ := os.ReadFile(target); string(content) != "first\n" {
+		t.Errorf("Expected file to be left untouched, but got %q", string(content))
+	}
+
+	errBuf.Reset()
+	shell.Execute("echo third >| " + target)
+	if errBuf.String() != "" {
+		t.Errorf("Expected no errors, but got: %q", errBuf.String())
+	}
+	if content, _ := os.ReadFile(target); string(content) != "third\n" {
+		t.Errorf("Expected '>|' to override noclobber, but got %q", string(content))
+	}
+}
+
+func TestShellReadHeredocLines(t *testing.T) {
+	shell, _, outBuf, _ := testShell()
+	shell.reader = bufio.NewReader(strings.NewReader("cat <<EOF; cat <<-END\none\nEOF\n\ttwo\n\tEND\necho after\ncat <<EOF\ncut short\n"))
+
+	for _, expected := range []string{
+		"cat <<EOF; cat <<-END\none\nEOF\n\ttwo\n\tEND",
+		"echo after",
+		"cat <<EOF\ncut short",
+	} {
+		line, err := shell.readCommandLine()
+		if err != nil || line != expected {
+			t.Errorf("Expected %q, but got %q and %v", expected, line, err)
+		}
+	}
+	if _, err := shell.readCommandLine(); err != io.EOF {
+		t.Errorf("Expected end of input, but got %v", err)
+	}
+	if outBuf.String() != "$ > > > > $ $ > > $ " {
+		t.Errorf("Expected continuation prompts for here-document lines, but got %q", outBuf.String())
+	}
+}
+
+func TestShellHeredocExpansion(t *testing.T) {
+	shell, _, outBuf, errBuf := testShell()
+
+	shell.Execute("X=val\ncat <<EOF\n$X ${X} \\$X \"$X\" \\\"q\\\" \\\\ 'x' \\\nnext\nEOF\ncat <<-EOF\n\t$X\n\tEOF")
+	if outBuf.String() != "val val $X \"val\" \\\"q\\\" \\ 'x' next\nval\n" {
+		t.Errorf("Expected unquoted here-documents to be expanded, but got %q", outBuf.String())
+	}
+
+	for _, delim := range []string{"'EOF'", "\"EOF\"", "\\EOF", "E'O'F"} {
+		outBuf.Reset()
+		shell.Execute("cat <<" + delim + "\n$X \\$X\nEOF")
+		if outBuf.String() != "$X \\$X\n" {
+			t.Errorf("Expected <<%s to keep the body literal, but got %q", delim, outBuf.String())
+		}
+	}
+	if errBuf.String() != "" {
+		t.Errorf("Expected no errors, but got: %q", errBuf.String())
+	}
+}
+
+func TestShellBackgroundJob(t *testing.T) {
+	shell, _, outBuf, errBuf := testShell()
+
+	shell.Execute("sleep 0 &")
+	if !strings.HasPrefix(errBuf.String(), "[1] ") {
+		t.Fatalf("Expected job number and pid on stderr, but got: %q", errBuf.String())
+	}
+
+	shell.Execute("wait %1")
+	shell.Execute("jobs")
+	expected := "[1]+  Done                    sleep 0\n"
+	if outBuf.String() != expected {
+		t.Errorf("Expected jobs output %q, but got %q", expected, outBuf.String())
+	}
+
+	outBuf.Reset()
+	shell.Execute("jobs")
+	if outBuf.String() != "" {
+		t.Errorf("Expected finished job to be reported only once, but got %q", outBuf.String())
+	}
+}
+
+func TestShellWaitStoppedJob(t *testing.T) {
+	shell, _, outBuf, _ := testShell()
+	shell.Execute("sleep 5 &")
+	job := shell.jobs.Jobs()[0]
+	defer job.cmd.Process.Kill()
+
+	syscall.Kill(-job.Pgid, syscall.SIGSTOP)
+	done := make(chan struct{})
+	go func() {
+		shell.Execute("wait %1; echo $?")
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Fatal("Expected wait to return for a stopped job")
+	}
+	if outBuf.String() != "147\n" {
+		t.Errorf("Expected status 128+SIGSTOP, but got %q", outBuf.String())
+	}
+}
+
+func TestJobTableFind(t *testing.T) {
+	shell, _, _, _ := testShell()
+	shell.Execute("sleep 5 &")
+	shell.Execute("sleep 6 &")
+	defer func() {
+		for _, job := range shell.jobs.Jobs() {
+			job.cmd.Process.Kill()
+			<-job.Done()
+		}
+	}()
+
+	tests := []struct {
+		spec        string
+		expectedID  int
+		expectError bool
+	}{
+		{spec: "%1", expectedID: 1},
+		{spec: "%2", expectedID: 2},
+		{spec: "%+", expectedID: 2},
+		{spec: "%%", expectedID: 2},
+		{spec: "%-", expectedID: 1},
+		{spec: "%?6", expectedID: 2},
+		{spec: "%sleep", expectError: true},
+		{spec: "%3", expectError: true},
+		{spec: "abc", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			job, err := shell.jobs.Find(tt.spec)
+			if (err != nil) != tt.expectError {
+				t.Fatalf("Find(%q) error = %v, expectError %v", tt.spec, err, tt.expectError)
+			}
+			if err == nil && job.ID != tt.expectedID {
+				t.Errorf("Find(%q) = job %d, want job %d", tt.spec, job.ID, tt.expectedID)
+			}
+		})
+	}
+}
+
+func TestShellStoppedJobResumedWithBg(t *testing.T) {
+	shell, _, outBuf, _ := testShell()
+	shell.Execute("sleep 5 &")
+	job, err := shell.jobs.Find("%1")
+	if err != nil {
+		t.Fatalf("Expected job to be found: %v", err)
+	}
+	defer func() {
+		job.cmd.Process.Kill()
+		<-job.Done()
+	}()
+
+	syscall.Kill(job.Pgid, syscall.SIGSTOP)
+	deadline := time.Now().Add(2 * time.Second)
+	for shell.jobs.State(job) != JobStopped && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	shell.Execute("jobs")
+	if !strings.Contains(outBuf.String(), "Stopped                 sleep 5") {
+		t.Fatalf("Expected stopped job in jobs output, but got %q", outBuf.String())
+	}
+
+	outBuf.Reset()
+	shell.Execute("bg %1")
+	if outBuf.String() != "[1]+ sleep 5 &\n" {
+		t.Errorf("Expected bg to report resumed job, but got %q", outBuf.String())
+	}
+	if state := shell.jobs.State(job); state != JobRunning {
+		t.Errorf("Expected job to be running after bg, but got state %d", state)
+	}
+}
+
+func TestShellTrapList(t *testing.T) {
+	shell, _, outBuf, errBuf := testShell()
+	shell.Execute("trap 'echo bye' EXIT")
+	shell.Execute("trap 'echo caught' 10 sigterm")
+	shell.Execute("trap -p")
+
+	expected := "trap -- 'echo bye' EXIT\ntrap -- 'echo caught' SIGUSR1\ntrap -- 'echo caught' SIGTERM\n"
+	if outBuf.String() != expected {
+		t.Errorf("Expected trap listing %q, but got %q", expected, outBuf.String())
+	}
+	shell.Execute("trap - USR1 TERM")
+
+	shell.Execute("trap x NOPE")
+	if !strings.Contains(errBuf.String(), "trap: NOPE: invalid signal specification") {
+		t.Errorf("Expected invalid signal error, but got %q", errBuf.String())
+	}
+}
+
+func TestShellTrapExit(t *testing.T) {
+	shell, _, outBuf, _ := testShell()
+	exitCode := -1
+	shell.exitFunc = func(code int) { exitCode = code }
+
+	shell.Execute("trap 'echo cleanup' EXIT")
+	shell.Execute("exit 3")
+
+	if exitCode != 3 {
+		t.Errorf("Expected exit code 3, but got %d", exitCode)
+	}
+	if outBuf.String() != "cleanup\n" {
+		t.Errorf("Expected EXIT trap to run before exiting, but got %q", outBuf.String())
+	}
+}
+
+func TestShellTrapErrAndDebug(t *testing.T) {
+	shell, _, outBuf, _ := testShell()
+	shell.builtins.Register("false", func(args []string, stdout, stderr io.Writer) error {
+		return errors.New("false")
+	})
+	shell.Execute("trap 'echo failed' ERR")
+	shell.Execute("echo ok; false")
+	if outBuf.String() != "ok\nfailed\n" {
+		t.Errorf("Expected ERR trap after the failing command only, but got %q", outBuf.String())
+	}
+	if shell.lastStatus != 1 {
+		t.Errorf("Expected ERR trap to preserve the exit status, but got %d", shell.lastStatus)
+	}
+
+	outBuf.Reset()
+	shell.Execute("trap - ERR; trap 'echo next' DEBUG")
+	shell.Execute("echo a; echo b")
+	if outBuf.String() != "next\na\nnext\nb\n" {
+		t.Errorf("Expected DEBUG trap before each command, but got %q", outBuf.String())
+	}
+}
+
+func TestShellTrapSignal(t *testing.T) {
+	shell, _, outBuf, _ := testShell()
+	shell.Execute("trap 'echo caught' USR2")
+	defer shell.Execute("trap - USR2")
+
+	syscall.Kill(syscall.Getpid(), syscall.SIGUSR2)
+	deadline := time.Now().Add(2 * time.Second)
+	for outBuf.Len() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		shell.runPendingTraps()
+	}
+
+	if outBuf.String() != "caught\n" {
+		t.Errorf("Expected USR2 trap to run between commands, but got %q", outBuf.String())
+	}
+}
+
+func TestShellHash(t *testing.T) {
+	shell, _, outBuf, errBuf := testShell()
+
+	shell.Execute("hash -p /bin/echo say")
+	shell.Execute("hash -t say")
+	shell.Execute("type say")
+	expected := "/bin/echo\nsay is hashed (/bin/echo)\n"
+	if outBuf.String() != expected {
+		t.Errorf("Expected %q, but got %q", expected, outBuf.String())
+	}
+
+	shell.Execute("hash -d nope")
+	if !strings.Contains(errBuf.String(), "hash: nope: not found") {
+		t.Errorf("Expected not found error, but got %q", errBuf.String())
+	}
+
+	// Assigning PATH forgets everything that was resolved with the old value
+	shell.Execute("PATH=$PATH:" + t.TempDir())
+	outBuf.Reset()
+	shell.Execute("hash")
+	if outBuf.String() != "hash: hash table empty\n" {
+		t.Errorf("Expected hash table to be emptied when PATH changes, but got %q", outBuf.String())
+	}
+}
+
+func TestShellHashShellPath(t *testing.T) {
+	shell, _, outBuf, errBuf := testShell()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "greet"), []byte("#!/bin/sh\necho hi\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	processPath := os.Getenv("PATH")
+
+	// An embedded shell searches its own PATH, which the process does not see,
+	// and running a command searches for it once and counts one hit
+	shell.Execute("PATH=" + dir + ":$PATH")
+	shell.Execute("greet")
+	shell.Execute("hash")
+	expected := "hi\nhits\tcommand\n   1\t" + filepath.Join(dir, "greet") + "\n"
+	if outBuf.String() != expected || errBuf.Len() != 0 {
+		t.Errorf("Expected %q, but got %q (stderr %q)", expected, outBuf.String(), errBuf.String())
+	}
+	if os.Getenv("PATH") != processPath {
+		t.Errorf("Expected the process PATH to be left alone, but got %q", os.Getenv("PATH"))
+	}
+	// Command names are completed from the same PATH
+	if names := shell.commandNames("gree"); !reflect.DeepEqual(names, []string{"greet"}) {
+		t.Errorf("Expected greet to be completed, but got %q", names)
+	}
+
+	outBuf.Reset()
+	shell.Execute("unset PATH; hash")
+	if outBuf.String() != "hash: hash table empty\n" {
+		t.Errorf("Expected unsetting PATH to empty the hash table, but got %q", outBuf.String())
+	}
+	if names := shell.commandNames("gree"); len(names) != 0 {
+		t.Errorf("Expected no commands without PATH, but got %q", names)
+	}
+}
+
+func TestShellExitStatus(t *testing.T) {
+	shell, _, outBuf, _ := testShell()
+	shell.Execute("sh -c 'exit 3'; echo $?")
+	shell.Execute("no-such-command-xyz; echo $?")
+	shell.Execute("fail; echo $?")
+
+	if outBuf.String() != "3\n127\n0\n" {
+		t.Errorf("Expected exit statuses 3, 127 and 0, but got %q", outBuf.String())
+	}
+
+	result := shell.executor.Execute("sh", []string{"-c", "kill -KILL $$"}, nil, io.Discard, io.Discard)
+	if result.Signal != syscall.SIGKILL || result.ExitCode != 128+int(syscall.SIGKILL) {
+		t.Errorf("Expected command killed by SIGKILL, but got %+v", result)
+	}
+	if result.WallTime <= 0 {
+		t.Errorf("Expected wall time to be recorded, but got %v", result.WallTime)
+	}
+}
+
+func TestShellTime(t *testing.T) {
+	shell, _, outBuf, errBuf := testShell()
+	shell.Execute("time -p echo hi")
+
+	if outBuf.String() != "hi\n" {
+		t.Errorf("Expected timed command output, but got %q", outBuf.String())
+	}
+	lines := strings.Split(strings.TrimSuffix(errBuf.String(), "\n"), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "real ") || !strings.HasPrefix(lines[2], "sys ") {
+		t.Errorf("Expected POSIX time report, but got %q", errBuf.String())
+	}
+}
+
+func TestShellTimeExternalUsage(t *testing.T) {
+	shell, _, _, errBuf := testShell()
+
+	// A background job that finishes while sleep runs is not counted as sleep's CPU time
+	shell.Execute("sh -c 'i=0; while [ $i -lt 300000 ]; do i=$((i+1)); done' &")
+	errBuf.Reset()
+	shell.Execute("TIMEFORMAT='%1R %2U'; time sleep 1.5")
+
+	var real, user float64
+	if _, err := fmt.Sscanf(errBuf.String(), "%f %f", &real, &user); err != nil {
+		t.Fatalf("Expected a time report, but got %q", errBuf.String())
+	}
+	if real < 1.5 || user > 0.1 {
+		t.Errorf("Expected sleep's own times, but got real %v and user %v", real, user)
+	}
+	shell.Execute("wait")
+}
+
+func TestFormatTiming(t *testing.T) {
+	timed := timing{real: 83*time.Second + 456789*time.Microsecond, user: 1500 * time.Millisecond, sys: 250 * time.Millisecond}
+
+	tests := []struct {
+		format   string
+		expected string
+	}{
+		{defaultTimeFormat, "\nreal\t1m23.456s\nuser\t0m1.500s\nsys\t0m0.250s"},
+		{posixTimeFormat, "real 83.45\nuser 1.50\nsys 0.25"},
+		{"%0R %1U %lS", "83 1.5 0m0.250s"},
+		{"%P%% %X", "2.10% %X"},
+	}
+	for _, tt := range tests {
+		if got := formatTiming(tt.format, timed); got != tt.expected {
+			t.Errorf("formatTiming(%q) = %q, want %q", tt.format, got, tt.expected)
+		}
+	}
+}
+
+func TestShellExecPermanentRedirections(t *testing.T) {
+	shell, _, outBuf, errBuf := testShell()
+	logFile := filepath.Join(t.TempDir(), "log.txt")
+
+	shell.Execute("exec 3> " + logFile)
+	shell.Execute("echo one >&3; echo two >&3")
+	// Commands inherit the shell's descriptors and their own redirections above 2
+	shell.Execute("sh -c 'echo child >&3'")
+	shell.Execute("sh -c 'echo own >&4' 4>&3")
+	shell.Execute("exec 3>&-")
+	shell.Execute("echo three >&3")
+	shell.Execute("sh -c 'echo closed >&3' 2>/dev/null")
+
+	content, err := os.ReadFile(logFile)
+	if err != nil {
+		t.Fatalf("Failed to read log file: %v", err)
+	}
+	if string(content) != "one\ntwo\nchild\nown\n" {
+		t.Errorf("Expected writes through descriptor 3, but got %q", string(content))
+	}
+	if !strings.Contains(errBuf.String(), "bad file descriptor") {
+		t.Errorf("Expected error writing to closed descriptor, but got %q", errBuf.String())
+	}
+
+	errBuf.Reset()
+	shell.Execute("exec 2>&1")
+	shell.Execute("fail now")
+	if errBuf.Len() != 0 || outBuf.String() != "Command failed: now\n" {
+		t.Errorf("Expected stderr to stay redirected to stdout, but got stdout %q, stderr %q", outBuf.String(), errBuf.String())
+	}
+
+	shell.Execute("exec no-such-command-xyz")
+	if !strings.Contains(outBuf.String(), "exec: no-such-command-xyz: not found") {
+		t.Errorf("Expected exec of a missing command to fail, but got %q", outBuf.String())
+	}
+}
+
+func TestShellCommandPaths(t *testing.T) {
+	shell, _, outBuf, errBuf := testShell()
+	dir := t.TempDir()
+	writeFile := func(name, content string, perm os.FileMode) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), perm); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+		return path
+	}
+	script := writeFile("script", "echo from script\nexit 5\n", 0755)
+	plain := writeFile("plain", "echo hi\n", 0644)
+
+	shell.Execute(script + "; echo $?")
+	shell.Execute(plain + "; echo $?")
+	shell.Execute(dir + "; echo $?")
+	shell.Execute(filepath.Join(dir, "missing") + "; echo $?")
+
+	if outBuf.String() != "from script\n5\n126\n126\n127\n" {
+		t.Errorf("Expected script output and exit statuses, but got %q", outBuf.String())
+	}
+	expectedErrors := []string{
+		plain + ": Permission denied",
+		dir + ": Is a directory",
+		filepath.Join(dir, "missing") + ": No such file or directory",
+	}
+	for _, expected := range expectedErrors {
+		if !strings.Contains(errBuf.String(), expected) {
+			t.Errorf("Expected error %q, but got %q", expected, errBuf.String())
+		}
+	}
+}
+
+func TestShellVariables(t *testing.T) {
+	shell, _, outBuf, errBuf := testShell()
+	shell.Execute("GREETING_VAR=hello; echo $GREETING_VAR \"${GREETING_VAR}!\"")
+	shell.Execute("PREFIX_VAR=1 sh -c 'echo in:$PREFIX_VAR'; echo out:$PREFIX_VAR")
+	shell.Execute("LIST_VAR='a  b c'; printf '<%s>' $LIST_VAR \"$LIST_VAR\" $UNSET_VAR; echo")
+	shell.Execute("IFS=:; PATH_VAR=a::b; printf '<%s>' $PATH_VAR; echo; unset IFS")
+
+	expected := "hello hello!\nin:1\nout:\n<a><b><c><a  b c>\n<a><><b>\n"
+	if outBuf.String() != expected {
+		t.Errorf("Expected %q, but got %q", expected, outBuf.String())
+	}
+	if errBuf.String() != "" {
+		t.Errorf("Expected no errors, but got %q", errBuf.String())
+	}
+}
+
+func TestShellExportReadonlyUnset(t *testing.T) {
+	shell, _, outBuf, errBuf := testShell()
+	shell.Execute("export EXPORTED_VAR='a b'; LOCAL_VAR=x")
+	shell.Execute("sh -c 'echo [$EXPORTED_VAR] [$LOCAL_VAR]'")
+	shell.Execute("export -p")
+	if !strings.Contains(outBuf.String(), "[a b] []\n") {
+		t.Errorf("Expected only exported variables in the environment, but got %q", outBuf.String())
+	}
+	if !strings.Contains(outBuf.String(), "export EXPORTED_VAR='a b'\n") || strings.Contains(outBuf.String(), "LOCAL_VAR") {
+		t.Errorf("Expected export -p to list exported variables, but got %q", outBuf.String())
+	}
+
+	outBuf.Reset()
+	shell.Execute("readonly FIXED_VAR=1; FIXED_VAR=2; echo $? $FIXED_VAR; unset FIXED_VAR")
+	shell.Execute("unset EXPORTED_VAR; echo [$EXPORTED_VAR]")
+	if outBuf.String() != "1 1\n[]\n" {
+		t.Errorf("Expected readonly and unset results, but got %q", outBuf.String())
+	}
+	expectedErr := "FIXED_VAR: readonly variable\nunset: FIXED_VAR: cannot unset: readonly variable\n"
+	if errBuf.String() != expectedErr {
+		t.Errorf("Expected %q, but got %q", expectedErr, errBuf.String())
+	}
+}
+
+func TestShellRestricted(t *testing.T) {
+	shell, _, outBuf, errBuf := testShell()
+	dir := t.TempDir()
+	shell.SetRestricted()
+
+	shell.Execute("cd " + dir)
+	shell.Execute("PATH=/tmp; export SHELL=/bin/sh; unset ENV")
+	shell.Execute("/bin/echo hi")
+	shell.Execute("echo hi > " + dir + "/out.txt")
+	shell.Execute("exec echo hi")
+	shell.Execute("source ./rc")
+	path, _ := shell.variable("PATH")
+	shell.Execute("read PATH <<EOF\n/tmp\nEOF")
+	shell.Execute("coproc SHELL cat; coproc PATH cat")
+	shell.Execute("compgen -F /usr/bin/touch " + dir + "/comp.txt; complete -F exec ls")
+	shell.Execute("echo allowed 2>&1; echo $?")
+
+	expectedErr := "cd: restricted\n" +
+		"PATH: restricted: cannot modify variable\n" +
+		"SHELL: restricted: cannot modify variable\n" +
+		"ENV: restricted: cannot modify variable\n" +
+		"/bin/echo: restricted: cannot specify `/' in command names\n" +
+		dir + "/out.txt: restricted: cannot redirect output\n" +
+		"exec: restricted\n" +
+		"source: ./rc: restricted\n" +
+		"read: PATH: restricted: cannot modify variable\n" +
+		"coproc: SHELL: restricted: cannot modify variable\n" +
+		"coproc: PATH: restricted: cannot modify variable\n" +
+		"compgen: /usr/bin/touch: restricted: cannot specify `/' in command names\n" +
+		"complete: exec: restricted\n"
+	if errBuf.String() != expectedErr {
+		t.Errorf("Expected %q, but got %q", expectedErr, errBuf.String())
+	}
+	if value, _ := shell.variable("PATH"); value != path {
+		t.Errorf("Expected PATH to stay %q, but got %q", path, value)
+	}
+	if _, ok := shell.variable("SHELL_PID"); ok {
+		t.Errorf("Expected no coprocess to be started")
+	}
+	if outBuf.String() != "allowed\n0\n" {
+		t.Errorf("Expected only the allowed command to run, but got %q", outBuf.String())
+	}
+	if _, err := os.Stat(dir + "/out.txt"); err == nil {
+		t.Errorf("Expected redirection target not to be created")
+	}
+	if _, err := os.Stat(dir + "/comp.txt"); err == nil {
+		t.Errorf("Expected the completion command not to run")
+	}
+}
+
+func TestShellXtrace(t *testing.T) {
+	shell, _, outBuf, errBuf := testShell()
+	shell.Execute("set -x; TRACE_VAR='x y' echo \"a b\" it\\'s \\$HOME > /dev/null")
+	shell.Execute("PS4='[$?] '; fail; set +x; echo untraced")
+
+	expectedErr := "+ TRACE_VAR='x y' echo 'a b' \"it's\" '$HOME'\n" +
+		"+ PS4='[$?] '\n" +
+		"[0] fail\n" +
+		"Command failed: \n" +
+		"[0] set +x\n"
+	if errBuf.String() != expectedErr {
+		t.Errorf("Expected %q, but got %q", expectedErr, errBuf.String())
+	}
+	if outBuf.String() != "untraced\n" {
+		t.Errorf("Expected untraced output, but got %q", outBuf.String())
+	}
+
+	// Nesting repeats the whole first character, even when it takes several bytes
+	shell.Execute("PS4='» '")
+	shell.depth = 3
+	if prefix := shell.tracePrefix(); prefix != "»»» " {
+		t.Errorf("Expected nested prefix %q, but got %q", "»»» ", prefix)
+	}
+}
+
+func TestShellErrexitAndNounset(t *testing.T) {
+	shell, _, outBuf, errBuf := testShell()
+	exitCode := -1
+	shell.exitFunc = func(code int) { exitCode = code }
+
+	shell.Execute("set -e; echo $-; sh -c 'exit 4'; echo unreachable")
+	if exitCode != 4 || outBuf.String() != "e\n" {
+		t.Errorf("Expected errexit to exit with 4 after printing flags, but got %d and %q", exitCode, outBuf.String())
+	}
+
+	shell, _, outBuf, errBuf = testShell()
+	exitCode = -1
+	shell.exitFunc = func(code int) { exitCode = code }
+	shell.Execute("set -u; SET_VAR=1; echo $SET_VAR $? $$ > /dev/null; echo ${UNBOUND_VAR}; echo unreachable")
+	if exitCode != 1 || outBuf.String() != "" {
+		t.Errorf("Expected nounset to exit with 1, but got %d and %q", exitCode, outBuf.String())
+	}
+	if errBuf.String() != "UNBOUND_VAR: unbound variable\n" {
+		t.Errorf("Expected unbound variable error, but got %q", errBuf.String())
+	}
+}
+
+func TestShellSetOptionList(t *testing.T) {
+	shell, _, outBuf, errBuf := testShell()
+	shell.Execute("set -o noclobber -x; set +x; set -o")
+
+	expected := "dryrun         \toff\nerrexit        \toff\nnoclobber      \ton\nnounset        \toff\npipefail       \toff\nxtrace         \toff\n"
+	if outBuf.String() != expected {
+		t.Errorf("Expected %q, but got %q", expected, outBuf.String())
+	}
+
+	outBuf.Reset()
+	shell.Execute("set +o")
+	if !strings.Contains(outBuf.String(), "set -o noclobber\nset +o nounset\nset +o pipefail\nset +o xtrace\n") {
+		t.Errorf("Expected set +o to print restoring commands, but got %q", outBuf.String())
+	}
+
+	errBuf.Reset()
+	shell.Execute("set -o pipefail")
+	if errBuf.String() != "set: pipefail: not supported, as the shell has no pipelines\n" || shell.lastStatus != 1 || shell.option("pipefail") {
+		t.Errorf("Expected pipefail to be refused, but got %q and status %d", errBuf.String(), shell.lastStatus)
+	}
+	errBuf.Reset()
+	shell.Execute("set +o pipefail")
+	if errBuf.String() != "" || shell.lastStatus != 0 {
+		t.Errorf("Expected turning pipefail off to succeed, but got %q and status %d", errBuf.String(), shell.lastStatus)
+	}
+}
+
+func TestShellDryRun(t *testing.T) {
+	shell, _, outBuf, errBuf := testShell()
+	dir := t.TempDir()
+	if err := shell.SetOption("dryrun", true); err != nil {
+		t.Fatal(err)
+	}
+
+	shell.Execute("DRY_VAR=1 sh -c 'exit 1' 2>> " + dir + "/log &")
+	shell.Execute("TARGET_VAR=" + dir + "; mkdir $TARGET_VAR/sub; echo $TARGET_VAR; cd /")
+	shell.Execute("echo hi > " + dir + "/out")
+	shell.Execute("cat <&3 2>&1")
+
+	expected := "dry-run: DRY_VAR=1 sh -c 'exit 1'\n" +
+		"  path: " + shell.executor.FindCommand("sh") + "\n" +
+		"  env: +DRY_VAR=1\n" +
+		"  redirect: 2>>" + dir + "/log\n" +
+		"  background\n" +
+		"dry-run: mkdir " + dir + "/sub\n" +
+		"  path: " + shell.executor.FindCommand("mkdir") + "\n" +
+		dir + "\n" +
+		"dry-run: cd /\n" +
+		"  path: (builtin)\n" +
+		"dry-run: echo hi\n" +
+		"  path: (builtin)\n" +
+		"  redirect: >" + dir + "/out\n" +
+		"dry-run: cat\n" +
+		"  path: " + shell.executor.FindCommand("cat") + "\n" +
+		"  redirect: 0<&3\n" +
+		"  redirect: 2>&1\n"
+	if outBuf.String() != expected {
+		t.Errorf("Expected %q, but got %q", expected, outBuf.String())
+	}
+	if errBuf.String() != "" || len(shell.jobs.Jobs()) != 0 {
+		t.Errorf("Expected nothing to run, but got errors %q", errBuf.String())
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("Expected no files to be created, but found %d", len(entries))
+	}
+}
+
+func TestShellAuditLog(t *testing.T) {
+	shell, _, _, _ := testShell()
+	path := t.TempDir() + "/audit.jsonl"
+	log, err := OpenAuditLog(path, regexp.MustCompile(`password`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	shell.SetAuditLog(log)
+	exitCode := -1
+	shell.exitFunc = func(code int) { exitCode = code }
+
+	shell.Execute("AUDIT_VAR=x; echo $AUDIT_VAR > /dev/null; sh -c 'exit 2'")
+	shell.Execute("echo password=hunter2")
+	shell.Execute("exit 5")
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) != 2 || exitCode != 5 {
+		t.Fatalf("Expected 2 audit entries before exit, but got %q", data)
+	}
+
+	var echo, sh AuditEntry
+	if err := json.Unmarshal([]byte(lines[0]), &echo); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &sh); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(echo.Argv, []string{"echo", "x"}) || !echo.Builtin ||
+		!reflect.DeepEqual(echo.Redirections, []string{">/dev/null"}) {
+		t.Errorf("Unexpected builtin entry %+v", echo)
+	}
+	if sh.Status != 2 || sh.Path == "" || sh.Line != "sh -c 'exit 2'" || sh.Cwd == "" {
+		t.Errorf("Unexpected external command entry %+v", sh)
+	}
+}
+
+func TestShellAuditLogDryRun(t *testing.T) {
+	shell, _, _, _ := testShell()
+	path := t.TempDir() + "/audit.jsonl"
+	log, err := OpenAuditLog(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shell.SetAuditLog(log)
+	shell.SetOption("dryrun", true)
+
+	// A described command is marked as such, while echo still runs
+	shell.Execute("sh -c 'exit 2'; echo hi")
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 audit entries, but got %q", data)
+	}
+	var sh, echo AuditEntry
+	if err := json.Unmarshal([]byte(lines[0]), &sh); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &echo); err != nil {
+		t.Fatal(err)
+	}
+	if !sh.DryRun || sh.Path != "" {
+		t.Errorf("Expected a dry-run entry without a path, but got %+v", sh)
+	}
+	if echo.DryRun || !echo.Builtin {
+		t.Errorf("Expected the builtin to be recorded as run, but got %+v", echo)
+	}
+}
+
+// execStub is an executor whose exec fails instead of replacing the process
+type execStub struct {
+	*executor.Service
+	argv []string
+	// atExec, if set, runs when exec is attempted
+	atExec func()
+}
+
+func (e *execStub) Exec(path string, argv, env []string) error {
+	e.argv = argv
+	if e.atExec != nil {
+		e.atExec()
+	}
+	return syscall.ENOEXEC
+}
+
+func TestShellExecFailure(t *testing.T) {
+	stub := &execStub{Service: executor.NewService()}
+	var outBuf, errBuf bytes.Buffer
+	shell := NewShellWithDependencies(new(bytes.Buffer), &outBuf, &errBuf, parser.NewService(), stub,
+		builtins.NewRegistry(&outBuf, &errBuf), NewIOManager(&outBuf, &errBuf))
+	dir := t.TempDir()
+	plain := filepath.Join(dir, "plain")
+	if err := os.WriteFile(plain, []byte("echo hi\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// A command that cannot be run is refused before the EXIT trap runs
+	shell.Execute("trap 'echo bye' EXIT; exec " + plain)
+	if outBuf.String() != "" || errBuf.String() != "exec: "+plain+": Permission denied\n" {
+		t.Errorf("Expected exec to fail before the trap, but got %q and %q", outBuf.String(), errBuf.String())
+	}
+
+	// When exec itself fails, the shell keeps its descriptors and its EXIT trap
+	var before, after syscall.Stat_t
+	syscall.Fstat(1, &before)
+	errBuf.Reset()
+	shell.Execute("exec true > " + filepath.Join(dir, "out"))
+	syscall.Fstat(1, &after)
+	if before.Dev != after.Dev || before.Ino != after.Ino {
+		t.Errorf("Expected standard output to be restored after exec failed")
+	}
+	if !reflect.DeepEqual(stub.argv, []string{"true"}) || errBuf.String() != "exec: true: exec format error\n" {
+		t.Errorf("Expected exec to be attempted and fail, but got %q and %q", stub.argv, errBuf.String())
+	}
+	shell.Execute("trap -p EXIT")
+	if outBuf.String() != "bye\ntrap -- 'echo bye' EXIT\n" {
+		t.Errorf("Expected the trap to run once and stay set, but got %q", outBuf.String())
+	}
+
+	// The program gets the shell's descriptors above 2, which are put back afterwards
+	logFile := filepath.Join(dir, "log")
+	var logStat, atExec, before9, after9 syscall.Stat_t
+	var atExecErr error
+	stub.atExec = func() { atExecErr = syscall.Fstat(9, &atExec) }
+	beforeErr := syscall.Fstat(9, &before9)
+	shell.Execute("exec 9> " + logFile + "; exec true")
+	syscall.Stat(logFile, &logStat)
+	if atExecErr != nil || atExec.Dev != logStat.Dev || atExec.Ino != logStat.Ino {
+		t.Errorf("Expected descriptor 9 to be the log at exec, but got %v", atExecErr)
+	}
+	afterErr := syscall.Fstat(9, &after9)
+	if (beforeErr == nil) != (afterErr == nil) || before9.Ino != after9.Ino {
+		t.Errorf("Expected descriptor 9 to be restored after exec failed, but got %v", afterErr)
+	}
+}
+
+func TestShellAuditLogStatements(t *testing.T) {
+	stub := &execStub{Service: executor.NewService()}
+	var outBuf, errBuf bytes.Buffer
+	shell := NewShellWithDependencies(new(bytes.Buffer), &outBuf, &errBuf, parser.NewService(), stub,
+		builtins.NewRegistry(&outBuf, &errBuf), NewIOManager(&outBuf, &errBuf))
+	path := t.TempDir() + "/audit.jsonl"
+	log, err := OpenAuditLog(path, regexp.MustCompile(`password`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	shell.SetAuditLog(log)
+
+	// Each statement of a script is recorded and redacted on its own
+	shell.Execute("echo one\necho password=hunter2; echo two\n  echo three &\nexec true x")
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	var execEntry AuditEntry
+	for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+		var entry AuditEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, entry.Line)
+		if entry.Exec {
+			execEntry = entry
+		}
+	}
+	expected := []string{"echo one", "echo two", "echo three &", "exec true x", "exec true x"}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Errorf("Expected lines %q, but got %q", expected, lines)
+	}
+	// The exec'd program is recorded before exec, and the failed exec after it
+	if !reflect.DeepEqual(execEntry.Argv, []string{"true", "x"}) || execEntry.Path == "" || stub.argv == nil {
+		t.Errorf("Unexpected exec entry %+v", execEntry)
+	}
+}
+
+func TestShellCommandNotFound(t *testing.T) {
+	shell, _, outBuf, errBuf := testShell()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "mytool"), []byte("#!/bin/sh\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	shell.Execute("PATH=" + dir)
+
+	shell.Execute("ehco hi; echo $?")
+	shell.Execute("mytol; zzzzqqq")
+	expectedErr := "ehco: command not found. Did you mean: echo?\n" +
+		"mytol: command not found. Did you mean: mytool?\n" +
+		"zzzzqqq: command not found\n"
+	if errBuf.String() != expectedErr || outBuf.String() != "127\n" {
+		t.Errorf("Expected suggestions %q, but got %q and output %q", expectedErr, errBuf.String(), outBuf.String())
+	}
+
+	outBuf.Reset()
+	shell.builtins.Register(commandNotFoundHandle, func(args []string, stdout, stderr io.Writer) error {
+		fmt.Fprintf(stdout, "handled %s\n", strings.Join(args, " "))
+		return nil
+	})
+	shell.Execute("nothere a b; echo $?")
+	if outBuf.String() != "handled nothere a b\n0\n" {
+		t.Errorf("Expected command_not_found_handle to run, but got %q", outBuf.String())
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{"git", "git", 0},
+		{"gti", "git", 1},
+		{"slep", "sleep", 1},
+		{"ehco", "echo", 1},
+		{"ls", "cat", 3},
+		{"", "abc", 3},
+	}
+	for _, tt := range tests {
+		if got := editDistance(tt.a, tt.b); got != tt.expected {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.expected)
+		}
+	}
+}
+
+func TestShellPseudoTerminal(t *testing.T) {
+	shell, inBuf, outBuf, errBuf := testShell()
+	runner := executor.NewService()
+	runner.SetPseudoTerminal(true)
+	runner.SetWindowSize(executor.WindowSize{Rows: 30, Cols: 100})
+	shell.executor = runner
+
+	inBuf.WriteString("typed")
+	shell.Execute("sh -c 'test -t 0 && test -t 1 && echo tty; stty size; read line; echo got $line; test -t 2 || echo stderr >&2'")
+
+	// The terminal echoes the typed input, wherever it arrives in the output
+	for _, expected := range []string{"tty\r\n", "30 100\r\n", "got typed\r\n"} {
+		if !strings.Contains(outBuf.String(), expected) {
+			t.Errorf("Expected terminal output %q, but got %q", expected, outBuf.String())
+		}
+	}
+	if errBuf.String() != "stderr\n" {
+		t.Errorf("Expected stderr to stay separate, but got %q", errBuf.String())
+	}
+}
+
+func TestShellPseudoTerminalStopsTyping(t *testing.T) {
+	shell, _, outBuf, errBuf := testShell()
+	runner := executor.NewService()
+	runner.SetPseudoTerminal(true)
+	shell.executor = runner
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+	shell.stdin = r
+
+	// Input that arrives after the command exits is left for the shell
+	shell.Execute("true")
+	w.WriteString("later\n")
+	buf := make([]byte, 16)
+	n, err := r.Read(buf)
+	if err != nil || string(buf[:n]) != "later\n" {
+		t.Errorf("Expected the input to be left unread, but got %q (%v)", buf[:n], err)
+	}
+
+	// So is input the command did not read, even more than the terminal holds
+	w.WriteString(strings.Repeat("x", 1<<16))
+	shell.Execute("true")
+	if shell.lastStatus != 0 || errBuf.Len() != 0 {
+		t.Errorf("Expected the command to succeed, but got status %d and %q (output %q)", shell.lastStatus, errBuf.String(), outBuf.String())
+	}
+}
+
+func TestShellCoproc(t *testing.T) {
+	shell, _, outBuf, errBuf := testShell()
+	shell.Execute("coproc tr a-z A-Z")
+	shell.Execute("echo ${COPROC[0]} ${COPROC[1]}; echo hello >&${COPROC[1]}; exec 61>&-")
+	shell.Execute("read -u ${COPROC[0]} line; echo got $line; wait $COPROC_PID")
+	if outBuf.String() != "60 61\ngot HELLO\n" || shell.lastStatus != 0 {
+		t.Errorf("Expected coprocess output through its descriptors, but got %q and status %d", outBuf.String(), shell.lastStatus)
+	}
+	if !strings.HasPrefix(errBuf.String(), "[1] ") {
+		t.Errorf("Expected the coprocess to be a job, but got %q", errBuf.String())
+	}
+
+	outBuf.Reset()
+	shell.Execute("coproc WORKER sh -c 'read x; echo x=$x; exit 3'")
+	shell.Execute("echo $WORKER ${WORKER[1]}; echo in >&${WORKER[1]}; read -u ${WORKER[0]}; echo $REPLY; wait $WORKER_PID")
+	if outBuf.String() != "61 62\nx=in\n" || shell.lastStatus != 3 {
+		t.Errorf("Expected named coprocess, but got %q and status %d", outBuf.String(), shell.lastStatus)
+	}
+}
+
+func TestShellRead(t *testing.T) {
+	shell, _, outBuf, errBuf := testShell()
+	shell.reader = bufio.NewReader(strings.NewReader("  one  two three  \nback\\\nslash\\x\nlast"))
+
+	shell.Execute("read a b; echo \"[$a] [$b]\"; read line; echo \"$line\"; read -r raw; echo \"$raw\"")
+	shell.Execute("read end; echo $? \"$end\"; read none; echo $? \"[$none]\"")
+	shell.Execute("IFS=: read x y z <<EOF\na::b:c\nEOF\necho \"$x|$y|$z\"")
+	expected := "[one] [two three]\nbackslashx\nlast\n" +
+		"1 \n1 []\n" +
+		"a||b:c\n"
+	if outBuf.String() != expected {
+		t.Errorf("Expected %q, but got %q", expected, outBuf.String())
+	}
+
+	shell.Execute("read -u 9 x; read 1x")
+	expectedErr := "read: 9: invalid file descriptor: bad file descriptor\nread: `1x': not a valid identifier\n"
+	if errBuf.String() != expectedErr {
+		t.Errorf("Expected %q, but got %q", expectedErr, errBuf.String())
+	}
+}
+
+func TestShellParallel(t *testing.T) {
+	shell, _, outBuf, errBuf := testShell()
+	shell.Execute("parallel -j1 echo {} {/} {.} ::: dir/a.txt b.tar.gz; parallel -j 1 echo item ::: last")
+	expected := "dir/a.txt a.txt dir/a\nb.tar.gz b.tar.gz b.tar\nitem last\n"
+	if outBuf.String() != expected {
+		t.Errorf("Expected %q, but got %q", expected, outBuf.String())
+	}
+
+	// Each job's output stays in one piece, whatever the order jobs finish in
+	outBuf.Reset()
+	shell.Execute("parallel -j 0 sh -c 'echo $0; sleep 0.05; echo $0' <<EOF\nx\ny\nz\nEOF")
+	for _, item := range []string{"x", "y", "z"} {
+		if !strings.Contains(outBuf.String(), item+"\n"+item+"\n") {
+			t.Errorf("Expected grouped output for %s, but got %q", item, outBuf.String())
+		}
+	}
+
+	shell.Execute("parallel sh -c 'exit $0' ::: 0 3 1")
+	if shell.lastStatus != 3 {
+		t.Errorf("Expected the worst status 3, but got %d", shell.lastStatus)
+	}
+
+	outBuf.Reset()
+	errBuf.Reset()
+	shell.Execute("parallel -j1 --halt soon,fail=1 sh -c 'echo $0; exit $0' ::: 0 2 0")
+	if outBuf.String() != "0\n2\n" || shell.lastStatus != 2 {
+		t.Errorf("Expected to halt after the first failure, but got %q and status %d", outBuf.String(), shell.lastStatus)
+	}
+
+	start := time.Now()
+	shell.Execute("parallel -j 3 --halt now,fail=1 sh -c 'sleep $0; exit 4' ::: 0 5 5")
+	if elapsed := time.Since(start); elapsed > 3*time.Second || shell.lastStatus != 4 {
+		t.Errorf("Expected running jobs to be killed, but took %v with status %d", elapsed, shell.lastStatus)
+	}
+	if !strings.Contains(errBuf.String(), "killing 2 running jobs") {
+		t.Errorf("Expected a halt message, but got %q", errBuf.String())
+	}
+
+	// In restricted mode, a command name that an item turns into a path is refused
+	outBuf.Reset()
+	errBuf.Reset()
+	shell.SetRestricted()
+	shell.Execute("parallel -j1 {} x ::: /bin/echo echo")
+	if outBuf.String() != "x\n" || shell.lastStatus != 1 {
+		t.Errorf("Expected only echo to run, but got %q and status %d", outBuf.String(), shell.lastStatus)
+	}
+	if errBuf.String() != "/bin/echo: restricted: cannot specify `/' in command names\n" {
+		t.Errorf("Expected a restricted error, but got %q", errBuf.String())
+	}
+}
+
+func TestShellTildeExpansion(t *testing.T) {
+	shell, _, outBuf, _ := testShell()
+	shell.Execute("HOME=/home/me; echo ~ ~/src \"~\" a~ ~root/x ~no_such_user/x")
+	expected := "/home/me /home/me/src ~ a~ /root/x ~no_such_user/x\n"
+	if outBuf.String() != expected {
+		t.Errorf("Expected %q, but got %q", expected, outBuf.String())
+	}
+}
+
+func TestShellCompleteLine(t *testing.T) {
+	shell, _, _, _ := testShell()
+	dir := t.TempDir()
+	for _, name := range []string{"my file.txt", "my folder/", "notes.md", ".hidden"} {
+		if strings.HasSuffix(name, "/") {
+			os.Mkdir(filepath.Join(dir, name), 0755)
+		} else {
+			os.WriteFile(filepath.Join(dir, name), nil, 0644)
+		}
+	}
+	shell.Execute("HOME=" + dir + "; COMPLETE_ME=1; COMPLETE_TOO=2")
+
+	tests := []struct {
+		line     string
+		start    int
+		expected []string
+	}{
+		{line: "readon", start: 0, expected: []string{"readonly"}},
+		{line: "echo hi; expo", start: 9, expected: []string{"export"}},
+		{line: "X=1 readon", start: 4, expected: []string{"readonly"}},
+		{line: "echo $COMPLETE_", start: 5, expected: []string{"$COMPLETE_ME", "$COMPLETE_TOO"}},
+		{line: "echo a${COMPLETE_M", start: 6, expected: []string{"${COMPLETE_ME}"}},
+		{line: "echo ~/my", start: 5, expected: []string{"~/my\\ file.txt", "~/my\\ folder/"}},
+		{line: "cat " + dir + "/no", start: 4, expected: []string{dir + "/notes.md"}},
+		{line: "cat \"" + dir + "/my fi", start: 4, expected: []string{"\"" + dir + "/my file.txt\""}},
+		{line: "cat <" + dir + "/.h", start: 5, expected: []string{dir + "/.hidden"}},
+		{line: "echo ~roo", start: 5, expected: []string{"~root/"}},
+	}
+	for _, tt := range tests {
+		start, completions := shell.completeLine([]rune(tt.line), len([]rune(tt.line)))
+		var texts []string
+		for _, c := range completions {
+			texts = append(texts, c.Text)
+		}
+		if start != tt.start || !reflect.DeepEqual(texts, tt.expected) {
+			t.Errorf("completeLine(%q) = %d, %q, want %d, %q", tt.line, start, texts, tt.start, tt.expected)
+		}
+	}
+}
+
+func TestShellCompleteBuiltins(t *testing.T) {
+	shell, _, outBuf, errBuf := testShell()
+	shell.Execute("complete -o nospace -W 'start stop \"re start\"' -F _svc svc; complete -d -A file cdx")
+	shell.Execute("complete; complete -r cdx; complete -p cdx; complete -p svc")
+	expected := "complete -d -f cdx\n" +
+		"complete -o nospace -W 'start stop \"re start\"' -F _svc svc\n" +
+		"complete -o nospace -W 'start stop \"re start\"' -F _svc svc\n"
+	if outBuf.String() != expected {
+		t.Errorf("Expected %q, but got %q", expected, outBuf.String())
+	}
+
+	outBuf.Reset()
+	shell.Execute("WORDS='alpha beta'; compgen -W '$WORDS all' al; compgen -A variable WORD; compgen -W x y; echo $?")
+	expected = "alpha\nall\nWORDS\n1\n"
+	if outBuf.String() != expected {
+		t.Errorf("Expected %q, but got %q", expected, outBuf.String())
+	}
+
+	shell.Execute("compgen -A alias x; complete -o bogus x; complete -W")
+	expectedErr := "complete: cdx: no completion specification\n" +
+		"compgen: alias: invalid action name\n" +
+		"complete: bogus: invalid option name\n" +
+		"complete: -W: option requires an argument\n"
+	if errBuf.String() != expectedErr {
+		t.Errorf("Expected %q, but got %q", expectedErr, errBuf.String())
+	}
+}
+
+func TestShellProgrammableCompletion(t *testing.T) {
+	shell, _, _, _ := testShell()
+	// The shell has no functions, so -F names a builtin that plays the function
+	var calls []string
+	shell.builtins.Register("_svc", func(args []string, stdout, stderr io.Writer) error {
+		words := shell.vars.Lookup("COMP_WORDS").Elements
+		cword, _ := shell.variable("COMP_CWORD")
+		calls = append(calls, fmt.Sprintf("%q %q %s", args, words, cword))
+		if args[2] == "--host" {
+			return shell.vars.SetArray("COMPREPLY", []string{"db1", "db2"})
+		}
+		fmt.Fprintln(stdout, "start")
+		fmt.Fprintln(stdout, "status")
+		return nil
+	})
+	dir := t.TempDir()
+	os.Mkdir(filepath.Join(dir, "sub"), 0755)
+	shell.Execute("complete -F _svc svc; complete -o nospace -W 'x=1 x=2' setx; complete -o filenames -d cdx")
+
+	tests := []struct {
+		line     string
+		expected []lineedit.Completion
+	}{
+		{line: "svc st", expected: []lineedit.Completion{{Text: "start"}, {Text: "status"}}},
+		{line: "svc --host ", expected: []lineedit.Completion{{Text: "db1"}, {Text: "db2"}}},
+		{line: "setx x", expected: []lineedit.Completion{{Text: "x=1", NoSpace: true}, {Text: "x=2", NoSpace: true}}},
+		{line: "cdx " + dir + "/s", expected: []lineedit.Completion{{Text: dir + "/sub/", Display: "sub/", NoSpace: true}}},
+		// The command name itself is not completed by the specification
+		{line: "sv", expected: nil},
+	}
+	for _, tt := range tests {
+		_, completions := shell.completeLine([]rune(tt.line), len([]rune(tt.line)))
+		if tt.expected == nil {
+			for _, c := range completions {
+				if c.Text == "start" {
+					t.Errorf("completeLine(%q) used the specification: %v", tt.line, completions)
+				}
+			}
+			continue
+		}
+		if !reflect.DeepEqual(completions, tt.expected) {
+			t.Errorf("completeLine(%q) = %v, want %v", tt.line, completions, tt.expected)
+		}
+	}
+
+	expectedCalls := []string{
+		`["svc" "st" "svc"] ["svc" "st"] 1`,
+		`["svc" "" "--host"] ["svc" "--host" ""] 2`,
+	}
+	if !reflect.DeepEqual(calls, expectedCalls) {
+		t.Errorf("Expected calls %q, but got %q", expectedCalls, calls)
+	}
+	if _, ok := shell.variable("COMP_LINE"); ok {
+		t.Errorf("Expected COMP_LINE to be unset after completion")
+	}
+
+	// Under dryrun the -F command does not run
+	calls = nil
+	shell.SetOption("dryrun", true)
+	if _, completions := shell.completeLine([]rune("svc st"), 6); len(completions) != 0 || len(calls) != 0 {
+		t.Errorf("Expected no completions under dryrun, but got %v and calls %q", completions, calls)
+	}
+}
@@ -0,0 +1,80 @@
+package shell
+
+import (
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"unsafe"
+)
+
+// terminalFd returns the file descriptor of r if it is a terminal, or -1 otherwise
+func terminalFd(r io.Reader) int {
+	file, ok := r.(*os.File)
+	if !ok {
+		return -1
+	}
+	fd := int(file.Fd())
+	if _, err := tcgetpgrp(fd); err != nil {
+		return -1
+	}
+	return fd
+}
+
+// tcgetpgrp returns the foreground process group of the terminal
+func tcgetpgrp(fd int) (int, error) {
+	var pgid int32
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), uintptr(syscall.TIOCGPGRP), uintptr(unsafe.Pointer(&pgid)))
+	if errno != 0 {
+		return 0, errno
+	}
+	return int(pgid), nil
+}
+
+// tcsetpgrp makes pgid the foreground process group of the terminal.
+// SIGTTOU is ignored for the duration of the call: the shell is in a background
+// group while taking the terminal back, and would otherwise be stopped. The signal
+// is not ignored permanently because children would inherit the ignored disposition.
+func tcsetpgrp(fd, pgid int) error {
+	signal.Ignore(syscall.SIGTTOU)
+	defer signal.Reset(syscall.SIGTTOU)
+
+	id := int32(pgid)
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), uintptr(syscall.TIOCSPGRP), uintptr(unsafe.Pointer(&id)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// initJobControl puts the interactive shell in its own process group in the
+// terminal's foreground and stops keyboard signals from killing it. The signals
+// are caught rather than ignored so that commands started later get the default
+// behaviour back.
+func (s *Shell) initJobControl() {
+	s.pgid = syscall.Getpid()
+	if err := syscall.Setpgid(0, 0); err != nil {
+		// A session leader cannot change its group, but already leads it
+		s.pgid = syscall.Getpgrp()
+	}
+	tcsetpgrp(s.tty, s.pgid)
+
+	s.catchSignals(keyboardSignals...)
+}
+
+// handleSignal reacts to a signal received by the shell itself, after any trap
+// for it has been queued. Jobs in the foreground receive keyboard signals directly
+// from the terminal.
+func (s *Shell) handleSignal(sig os.Signal) {
+	if sig == syscall.SIGINT && s.atPrompt.Load() {
+		// The terminal discards the partial line; start over on a fresh one
+		io.WriteString(s.stdout, "\n"+s.prompt)
+	}
+}
+
+// reclaimTerminal gives the terminal back to the shell after a foreground job
+func (s *Shell) reclaimTerminal() {
+	if s.tty >= 0 {
+		tcsetpgrp(s.tty, s.pgid)
+	}
+}
@@ -0,0 +1,140 @@
+package shell
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/codecrafters-io/shell-starter-go/app/syntax"
+)
+
+// defaultTimeFormat is used when TIMEFORMAT is unset, as in bash
+const defaultTimeFormat = "\nreal\t%3lR\nuser\t%3lU\nsys\t%3lS"
+
+// posixTimeFormat is used by "time -p"
+const posixTimeFormat = "real %2R\nuser %2U\nsys %2S"
+
+// timing holds the elapsed real time and CPU times of a timed statement
+type timing struct {
+	real, user, sys time.Duration
+}
+
+// cpuTimes returns the user and system CPU time the shell has used so far
+func cpuTimes() (user, sys time.Duration) {
+	var self syscall.Rusage
+	syscall.Getrusage(syscall.RUSAGE_SELF, &self)
+	return time.Duration(self.Utime.Nano()), time.Duration(self.Stime.Nano())
+}
+
+// timeStmt runs a statement prefixed by the time keyword and reports how long it took on stderr.
+// An external command is timed by the resource usage the executor reports for it, as the
+// shell cannot tell its own children apart from others, such as background jobs finishing
+// meanwhile. A builtin, which runs in the shell, is timed by the shell's own usage.
+func (s *Shell) timeStmt(stmt *syntax.Stmt, ioManager IOManagerWithRedirections) int {
+	s.lastResult = nil
+	startUser, startSys := cpuTimes()
+	start := time.Now()
+
+	status := s.executeStmt(stmt, ioManager)
+
+	var t timing
+	if result := s.lastResult; result != nil && result.Err == nil {
+		t = timing{real: result.WallTime, user: result.UserTime, sys: result.SysTime}
+	} else {
+		t.real = time.Since(start)
+		user, sys := cpuTimes()
+		t.user = user - startUser
+		t.sys = sys - startSys
+	}
+
+	format := defaultTimeFormat
+	if stmt.Time.PosixFormat {
+		format = posixTimeFormat
+	} else if value, ok := s.variable("TIMEFORMAT"); ok {
+		format = value
+	}
+	// An empty TIMEFORMAT disables the report
+	if format != "" {
+		fmt.Fprintln(s.stderr, formatTiming(format, t))
+	}
+	return status
+}
+
+// formatTiming expands a TIMEFORMAT string. %R, %U and %S are the real, user and
+// system times in seconds and %P the CPU percentage. A digit after the '%' sets the
+// number of decimals (at most 3, default 3) and an 'l' selects the MMmSS.FFFs form.
+func formatTiming(format string, t timing) string {
+	var sb strings.Builder
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+		if c != '%' || i+1 >= len(format) {
+			sb.WriteByte(c)
+			continue
+		}
+
+		j := i + 1
+		if format[j] == '%' {
+			sb.WriteByte('%')
+			i = j
+			continue
+		}
+		precision := 3
+		if format[j] >= '0' && format[j] <= '9' {
+			precision = min(int(format[j]-'0'), 3)
+			j++
+		}
+		long := false
+		if j < len(format) && format[j] == 'l' {
+			long = true
+			j++
+		}
+		if j >= len(format) {
+			sb.WriteString(format[i:])
+			break
+		}
+
+		switch format[j] {
+		case 'R':
+			sb.WriteString(formatSeconds(t.real, precision, long))
+		case 'U':
+			sb.WriteString(formatSeconds(t.user, precision, long))
+		case 'S':
+			sb.WriteString(formatSeconds(t.sys, precision, long))
+		case 'P':
+			percent := 0.0
+			if t.real > 0 {
+				percent = float64(t.user+t.sys) / float64(t.real) * 100
+			}
+			fmt.Fprintf(&sb, "%.2f", percent)
+		default:
+			// Unknown conversions are printed as written
+			sb.WriteString(format[i : j+1])
+		}
+		i = j
+	}
+	return sb.String()
+}
+
+// formatSeconds formats a duration as seconds with the given number of decimals,
+// truncating like bash, or as minutes and seconds in the long form
+func formatSeconds(d time.Duration, precision int, long bool) string {
+	var sb strings.Builder
+	seconds := d / time.Second
+	if long {
+		fmt.Fprintf(&sb, "%dm", seconds/60)
+		seconds %= 60
+	}
+	fmt.Fprintf(&sb, "%d", seconds)
+	if precision > 0 {
+		scale := time.Second
+		for n := 0; n < precision; n++ {
+			scale /= 10
+		}
+		fmt.Fprintf(&sb, ".%0*d", precision, (d%time.Second)/scale)
+	}
+	if long {
+		sb.WriteByte('s')
+	}
+	return sb.String()
+}
@@ -0,0 +1,49 @@
+package shell
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/codecrafters-io/shell-starter-go/app/syntax"
+)
+
+// defaultPS4 prefixes traced commands when PS4 is unset
+const defaultPS4 = "+ "
+
+// traceCommand prints a command to w after expansion, as "set -x" does, quoting
+// each word so that the line can be pasted back into the shell
+func (s *Shell) traceCommand(w io.Writer, assigns []assignment, args []string) {
+	if !s.option("xtrace") || (len(assigns) == 0 && len(args) == 0) {
+		return
+	}
+
+	words := make([]string, 0, len(assigns)+len(args))
+	for _, a := range assigns {
+		words = append(words, a.name+"="+syntax.Quote(a.value))
+	}
+	for _, arg := range args {
+		words = append(words, syntax.Quote(arg))
+	}
+	fmt.Fprintf(w, "%s%s\n", s.tracePrefix(), strings.Join(words, " "))
+}
+
+// tracePrefix returns the expanded value of PS4, with its first character repeated
+// once more for each level of nesting, such as a trap action run by a traced command
+func (s *Shell) tracePrefix() string {
+	ps4, ok := s.variable("PS4")
+	if !ok {
+		ps4 = defaultPS4
+	}
+	var sb strings.Builder
+	s.expandParts(&sb, syntax.ParseQuoted(ps4).Parts, true)
+	prefix := sb.String()
+
+	if prefix == "" || s.depth <= 1 {
+		return prefix
+	}
+	_, size := utf8.DecodeRuneInString(prefix)
+	first := prefix[:size]
+	return strings.Repeat(first, s.depth-1) + prefix
+}
@@ -0,0 +1,358 @@
+package shell
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/codecrafters-io/shell-starter-go/app/syntax"
+)
+
+// trapSignal is a signal that can be named in a trap command
+type trapSignal struct {
+	// name is the signal name without the SIG prefix
+	name string
+	sig  syscall.Signal
+}
+
+// trapSignals lists the signals known to the trap builtin, in signal number order
+var trapSignals = []trapSignal{
+	{"HUP", syscall.SIGHUP},
+	{"INT", syscall.SIGINT},
+	{"QUIT", syscall.SIGQUIT},
+	{"ILL", syscall.SIGILL},
+	{"TRAP", syscall.SIGTRAP},
+	{"ABRT", syscall.SIGABRT},
+	{"BUS", syscall.SIGBUS},
+	{"FPE", syscall.SIGFPE},
+	{"KILL", syscall.SIGKILL},
+	{"USR1", syscall.SIGUSR1},
+	{"SEGV", syscall.SIGSEGV},
+	{"USR2", syscall.SIGUSR2},
+	{"PIPE", syscall.SIGPIPE},
+	{"ALRM", syscall.SIGALRM},
+	{"TERM", syscall.SIGTERM},
+	{"CHLD", syscall.SIGCHLD},
+	{"CONT", syscall.SIGCONT},
+	{"STOP", syscall.SIGSTOP},
+	{"TSTP", syscall.SIGTSTP},
+	{"TTIN", syscall.SIGTTIN},
+	{"TTOU", syscall.SIGTTOU},
+	{"URG", syscall.SIGURG},
+	{"XCPU", syscall.SIGXCPU},
+	{"XFSZ", syscall.SIGXFSZ},
+	{"VTALRM", syscall.SIGVTALRM},
+	{"PROF", syscall.SIGPROF},
+	{"WINCH", syscall.SIGWINCH},
+	{"IO", syscall.SIGIO},
+	{"SYS", syscall.SIGSYS},
+}
+
+// Pseudo-signals are trap conditions raised by the shell itself rather than by the kernel:
+// EXIT when the shell exits, ERR when a command fails, DEBUG before each simple command
+// and RETURN when a function or sourced script returns
+const (
+	trapExit   = "EXIT"
+	trapErr    = "ERR"
+	trapDebug  = "DEBUG"
+	trapReturn = "RETURN"
+)
+
+// keyboardSignals are caught by an interactive shell so that only the foreground job receives them
+var keyboardSignals = []os.Signal{syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTSTP}
+
+// trapConditions returns every trap condition in the order used by "trap -p"
+func trapConditions() []string {
+	conditions := []string{trapExit}
+	for _, ts := range trapSignals {
+		conditions = append(conditions, ts.name)
+	}
+	return append(conditions, trapDebug, trapErr, trapReturn)
+}
+
+// lookupTrapCondition resolves a trap condition given as a signal name (with or
+// without the SIG prefix, in any case), a signal number, or a pseudo-signal.
+// sig is zero for pseudo-signals.
+func lookupTrapCondition(spec string) (name string, sig syscall.Signal, ok bool) {
+	if n, err := strconv.Atoi(spec); err == nil {
+		if n == 0 {
+			return trapExit, 0, true
+		}
+		for _, ts := range trapSignals {
+			if int(ts.sig) == n {
+				return ts.name, ts.sig, true
+			}
+		}
+		return "", 0, false
+	}
+
+	upper := strings.TrimPrefix(strings.ToUpper(spec), "SIG")
+	switch upper {
+	case trapExit, trapErr, trapDebug, trapReturn:
+		return upper, 0, true
+	}
+	for _, ts := range trapSignals {
+		if ts.name == upper {
+			return ts.name, ts.sig, true
+		}
+	}
+	return "", 0, false
+}
+
+// signalName returns the trap condition name of a signal
+func signalName(sig os.Signal) string {
+	for _, ts := range trapSignals {
+		if ts.sig == sig {
+			return ts.name
+		}
+	}
+	return ""
+}
+
+// TrapTable holds the shell's trap actions and the trapped signals waiting to be handled.
+// Signals arrive on the dispatcher goroutine, so access is synchronized.
+type TrapTable struct {
+	mu      sync.Mutex
+	actions map[string]string
+	pending []string
+}
+
+// NewTrapTable creates an empty trap table
+func NewTrapTable() *TrapTable {
+	return &TrapTable{actions: make(map[string]string)}
+}
+
+// Set sets the action for a condition; an empty action means the condition is ignored
+func (t *TrapTable) Set(name, action string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.actions[name] = action
+}
+
+// Reset removes the action for a condition
+func (t *TrapTable) Reset(name string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.actions, name)
+}
+
+// Action returns the action set for a condition
+func (t *TrapTable) Action(name string) (string, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	action, ok := t.actions[name]
+	return action, ok
+}
+
+// Queue records a trapped signal to be handled between commands.
+// It reports whether the signal has an action.
+func (t *TrapTable) Queue(name string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.actions[name] == "" {
+		return false
+	}
+	t.pending = append(t.pending, name)
+	return true
+}
+
+// TakePending returns the queued signals in arrival order and clears the queue
+func (t *TrapTable) TakePending() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	pending := t.pending
+	t.pending = nil
+	return pending
+}
+
+// catchSignals delivers the given signals to the shell's dispatcher goroutine,
+// starting it on first use
+func (s *Shell) catchSignals(sigs ...os.Signal) {
+	s.signalsOnce.Do(func() {
+		s.signals = make(chan os.Signal, 16)
+		go s.dispatchSignals(s.signals)
+	})
+	signal.Notify(s.signals, sigs...)
+}
+
+// dispatchSignals queues trapped signals for runPendingTraps; trap actions are
+// never run from this goroutine because a command may be executing
+func (s *Shell) dispatchSignals(signals <-chan os.Signal) {
+	for sig := range signals {
+		s.traps.Queue(signalName(sig))
+		s.handleSignal(sig)
+	}
+}
+
+// isKeyboardSignal reports whether an interactive shell catches sig for job control
+func (s *Shell) isKeyboardSignal(sig syscall.Signal) bool {
+	if s.tty < 0 {
+		return false
+	}
+	for _, k := range keyboardSignals {
+		if k == sig {
+			return true
+		}
+	}
+	return false
+}
+
+// setTrap installs action for a condition and updates the signal disposition
+func (s *Shell) setTrap(name string, sig syscall.Signal, action string) {
+	s.traps.Set(name, action)
+	if sig == 0 {
+		return
+	}
+	if action == "" {
+		// Ignored signals stay ignored in the commands the shell starts
+		signal.Ignore(sig)
+		return
+	}
+	s.catchSignals(sig)
+}
+
+// resetTrap removes the trap for a condition and restores the signal's disposition
+func (s *Shell) resetTrap(name string, sig syscall.Signal) {
+	s.traps.Reset(name)
+	if sig == 0 {
+		return
+	}
+	if s.isKeyboardSignal(sig) {
+		s.catchSignals(sig)
+		return
+	}
+	signal.Reset(sig)
+}
+
+// runTrap runs the action trapped for a condition, if any. Traps do not fire
+// while another trap is running, and the exit status is preserved across the action.
+func (s *Shell) runTrap(name string) {
+	if s.inTrap {
+		return
+	}
+	action, ok := s.traps.Action(name)
+	if !ok || action == "" {
+		return
+	}
+
+	s.inTrap = true
+	status := s.lastStatus
+	s.Execute(action)
+	s.lastStatus = status
+	s.inTrap = false
+}
+
+// runPendingTraps runs the actions for trapped signals received since the last call
+func (s *Shell) runPendingTraps() {
+	if s.inTrap {
+		return
+	}
+	for _, name := range s.traps.TakePending() {
+		s.runTrap(name)
+	}
+}
+
+// exit runs the EXIT trap, closes the audit log and terminates the shell with the given status
+func (s *Shell) exit(code int) {
+	s.runTrap(trapExit)
+	// The EXIT trap runs at most once, even if it calls exit itself
+	s.traps.Reset(trapExit)
+	if s.audit != nil {
+		if err := s.audit.Close(); err != nil {
+			fmt.Fprintf(s.stderr, "%s\n", err.Error())
+		}
+		s.audit = nil
+	}
+	s.exitFunc(code)
+}
+
+// handleTrap handles the 'trap' built-in command: "trap [-lp] [[action] condition ...]"
+func (s *Shell) handleTrap(args []string, stdout, stderr io.Writer) error {
+	printTraps := false
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") && args[0] != "-" {
+		arg := args[0]
+		args = args[1:]
+		if arg == "--" {
+			break
+		}
+		for _, c := range arg[1:] {
+			switch c {
+			case 'l':
+				s.listSignals(stdout)
+				return nil
+			case 'p':
+				printTraps = true
+			default:
+				return fmt.Errorf("trap: -%c: invalid option", c)
+			}
+		}
+	}
+
+	if len(args) == 0 || printTraps {
+		return s.printTraps(stdout, args)
+	}
+
+	// A single operand, or a leading '-', resets the named conditions
+	action, reset := args[0], false
+	if len(args) == 1 {
+		reset = true
+	} else {
+		args = args[1:]
+		reset = action == "-"
+	}
+
+	for _, spec := range args {
+		if _, _, ok := lookupTrapCondition(spec); !ok {
+			return fmt.Errorf("trap: %s: invalid signal specification", spec)
+		}
+	}
+	for _, spec := range args {
+		name, sig, _ := lookupTrapCondition(spec)
+		if reset {
+			s.resetTrap(name, sig)
+		} else {
+			s.setTrap(name, sig, action)
+		}
+	}
+	return nil
+}
+
+// printTraps prints the traps for the given conditions, or all set traps, in a form
+// that can be read back as input
+func (s *Shell) printTraps(stdout io.Writer, specs []string) error {
+	names := trapConditions()
+	if len(specs) > 0 {
+		names = nil
+		for _, spec := range specs {
+			name, _, ok := lookupTrapCondition(spec)
+			if !ok {
+				return fmt.Errorf("trap: %s: invalid signal specification", spec)
+			}
+			names = append(names, name)
+		}
+	}
+
+	for _, name := range names {
+		action, ok := s.traps.Action(name)
+		if !ok {
+			continue
+		}
+		if _, sig, _ := lookupTrapCondition(name); sig != 0 {
+			name = "SIG" + name
+		}
+		fmt.Fprintf(stdout, "trap -- %s %s\n", syntax.Quote(action), name)
+	}
+	return nil
+}
+
+// listSignals prints the signal numbers and names for "trap -l"
+func (s *Shell) listSignals(stdout io.Writer) {
+	for _, ts := range trapSignals {
+		fmt.Fprintf(stdout, "%2d) SIG%s\n", int(ts.sig), ts.name)
+	}
+}
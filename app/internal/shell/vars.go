@@ -0,0 +1,407 @@
+package shell
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/codecrafters-io/shell-starter-go/app/syntax"
+)
+
+// Variable is a shell variable and its attributes
+type Variable struct {
+	Name  string
+	Value string
+	// Set is false for a variable that was exported or made read-only but never assigned
+	Set      bool
+	Exported bool
+	ReadOnly bool
+	// Elements holds the values of an indexed array, such as the descriptors of a
+	// coprocess. Element 0 is also the Value, which is what $name expands to.
+	Elements []string
+}
+
+// VarTable holds the shell's variables. The environment of the commands the
+// shell runs is built from its exported variables. When syncProcess is set,
+// the process environment mirrors them too, so that code reading os.Getenv,
+// such as PATH lookups, sees the values the user assigned.
+type VarTable struct {
+	vars        map[string]*Variable
+	syncProcess bool
+	// pathChanged, if set, is called with the value of PATH whenever PATH changes,
+	// or with "" when it is unset
+	pathChanged func(path string)
+}
+
+// NewVarTable creates a variable table holding the given environment, as
+// "name=value" entries, as exported variables
+func NewVarTable(environ []string) *VarTable {
+	t := &VarTable{vars: make(map[string]*Variable)}
+	for _, entry := range environ {
+		name, value, ok := strings.Cut(entry, "=")
+		if ok && isName(name) {
+			t.vars[name] = &Variable{Name: name, Value: value, Set: true, Exported: true}
+		}
+	}
+	return t
+}
+
+// isName reports whether s is a valid variable name
+func isName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, c := range s {
+		switch {
+		case c == '_', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		case c >= '0' && c <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Get returns the value of a variable that is set
+func (t *VarTable) Get(name string) (string, bool) {
+	v, ok := t.vars[name]
+	if !ok || !v.Set {
+		return "", false
+	}
+	return v.Value, true
+}
+
+// Lookup returns a variable with its attributes, or nil if it does not exist
+func (t *VarTable) Lookup(name string) *Variable {
+	return t.vars[name]
+}
+
+// variable returns the named variable, creating it unset if needed
+func (t *VarTable) variable(name string) *Variable {
+	v, ok := t.vars[name]
+	if !ok {
+		v = &Variable{Name: name}
+		t.vars[name] = v
+	}
+	return v
+}
+
+// Set assigns a value to a variable, keeping its attributes
+func (t *VarTable) Set(name, value string) error {
+	if v, ok := t.vars[name]; ok && v.ReadOnly {
+		return fmt.Errorf("%s: readonly variable", name)
+	}
+	v := t.variable(name)
+	v.Value = value
+	v.Set = true
+	if len(v.Elements) > 0 {
+		v.Elements[0] = value
+	}
+	t.sync(v)
+	return nil
+}
+
+// SetArray assigns the values of an indexed array to a variable, keeping its attributes
+func (t *VarTable) SetArray(name string, values []string) error {
+	if v, ok := t.vars[name]; ok && v.ReadOnly {
+		return fmt.Errorf("%s: readonly variable", name)
+	}
+	v := t.variable(name)
+	v.Elements = append([]string(nil), values...)
+	v.Value = ""
+	if len(values) > 0 {
+		v.Value = values[0]
+	}
+	v.Set = true
+	t.sync(v)
+	return nil
+}
+
+// Element returns an element of a variable that is set. A variable that is not an
+// array only has element 0, its value.
+func (t *VarTable) Element(name string, index int) (string, bool) {
+	v, ok := t.vars[name]
+	switch {
+	case !ok || !v.Set:
+		return "", false
+	case len(v.Elements) == 0:
+		return v.Value, index == 0
+	case index < 0 || index >= len(v.Elements):
+		return "", false
+	}
+	return v.Elements[index], true
+}
+
+// Unset removes a variable
+func (t *VarTable) Unset(name string) error {
+	v, ok := t.vars[name]
+	if !ok {
+		return nil
+	}
+	if v.ReadOnly {
+		return fmt.Errorf("%s: cannot unset: readonly variable", name)
+	}
+	delete(t.vars, name)
+	t.sync(&Variable{Name: name})
+	return nil
+}
+
+// Export sets or clears the export attribute of a variable
+func (t *VarTable) Export(name string, exported bool) {
+	v := t.variable(name)
+	v.Exported = exported
+	t.sync(v)
+}
+
+// SetReadOnly marks a variable read-only
+func (t *VarTable) SetReadOnly(name string) {
+	t.variable(name).ReadOnly = true
+}
+
+// snapshot returns a copy of a variable, or nil if it does not exist
+func (t *VarTable) snapshot(name string) *Variable {
+	v, ok := t.vars[name]
+	if !ok {
+		return nil
+	}
+	copied := *v
+	copied.Elements = append([]string(nil), v.Elements...)
+	return &copied
+}
+
+// restore puts back a variable saved by snapshot, removing it if it did not exist
+func (t *VarTable) restore(name string, saved *Variable) {
+	if saved == nil {
+		saved = &Variable{Name: name}
+		delete(t.vars, name)
+	} else {
+		t.vars[name] = saved
+	}
+	t.sync(saved)
+}
+
+// sync updates the process environment after a change to v
+func (t *VarTable) sync(v *Variable) {
+	if v.Name == "PATH" && t.pathChanged != nil {
+		path := ""
+		if v.Set {
+			path = v.Value
+		}
+		t.pathChanged(path)
+	}
+	if !t.syncProcess {
+		return
+	}
+	if v.Exported && v.Set {
+		os.Setenv(v.Name, v.Value)
+	} else {
+		os.Unsetenv(v.Name)
+	}
+}
+
+// Variables returns all variables sorted by name
+func (t *VarTable) Variables() []*Variable {
+	vars := make([]*Variable, 0, len(t.vars))
+	for _, v := range t.vars {
+		vars = append(vars, v)
+	}
+	sort.Slice(vars, func(i, j int) bool {
+		return vars[i].Name < vars[j].Name
+	})
+	return vars
+}
+
+// Environ returns the environment for a command as "name=value" entries: the
+// exported variables that are set, overridden by the command's own assignments
+func (t *VarTable) Environ(assigns []assignment) []string {
+	values := make(map[string]string)
+	for name, v := range t.vars {
+		if v.Exported && v.Set {
+			values[name] = v.Value
+		}
+	}
+	for _, a := range assigns {
+		values[a.name] = a.value
+	}
+
+	env := make([]string, 0, len(values))
+	for name, value := range values {
+		env = append(env, name+"="+value)
+	}
+	sort.Strings(env)
+	return env
+}
+
+// assignment is a "name=value" word in front of a command
+type assignment struct {
+	name, value string
+}
+
+// variable returns the value of a shell variable
+func (s *Shell) variable(name string) (string, bool) {
+	return s.vars.Get(name)
+}
+
+// assign applies assignments to the shell's variables, stopping at the first error
+func (s *Shell) assign(assigns []assignment) error {
+	for _, a := range assigns {
+		if err := s.vars.Set(a.name, a.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// withAssignments runs fn with assignments applied to the shell's variables,
+// then restores the previous values, as for "IFS=, builtin ..."
+func (s *Shell) withAssignments(assigns []assignment, fn func() int) int {
+	saved := make([]*Variable, len(assigns))
+	for i, a := range assigns {
+		saved[i] = s.vars.snapshot(a.name)
+	}
+	if err := s.assign(assigns); err != nil {
+		fmt.Fprintf(s.stderr, "%s\n", err.Error())
+		return 1
+	}
+
+	defer func() {
+		for i := len(assigns) - 1; i >= 0; i-- {
+			s.vars.restore(assigns[i].name, saved[i])
+		}
+	}()
+	return fn()
+}
+
+// handleExport handles the 'export' built-in command: "export [-n] [-p] [name[=value] ...]"
+func (s *Shell) handleExport(args []string, stdout, stderr io.Writer) error {
+	unexport := false
+	for len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' {
+		arg := args[0]
+		args = args[1:]
+		if arg == "--" {
+			break
+		}
+		for _, c := range arg[1:] {
+			switch c {
+			case 'n':
+				unexport = true
+			case 'p':
+			default:
+				return fmt.Errorf("export: -%c: invalid option", c)
+			}
+		}
+	}
+
+	if len(args) == 0 {
+		s.printVariables(stdout, "export", func(v *Variable) bool { return v.Exported })
+		return nil
+	}
+
+	var err error
+	for _, arg := range args {
+		name, value, hasValue := strings.Cut(arg, "=")
+		if !isName(name) {
+			err = fmt.Errorf("export: `%s': not a valid identifier", arg)
+			continue
+		}
+		if hasValue {
+			if setErr := s.vars.Set(name, value); setErr != nil {
+				err = fmt.Errorf("export: %s", setErr.Error())
+				continue
+			}
+		}
+		s.vars.Export(name, !unexport)
+	}
+	return err
+}
+
+// handleReadonly handles the 'readonly' built-in command: "readonly [-p] [name[=value] ...]"
+func (s *Shell) handleReadonly(args []string, stdout, stderr io.Writer) error {
+	for len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' {
+		arg := args[0]
+		args = args[1:]
+		if arg == "--" {
+			break
+		}
+		if arg != "-p" {
+			return fmt.Errorf("readonly: %s: invalid option", arg)
+		}
+	}
+
+	if len(args) == 0 {
+		s.printVariables(stdout, "readonly", func(v *Variable) bool { return v.ReadOnly })
+		return nil
+	}
+
+	var err error
+	for _, arg := range args {
+		name, value, hasValue := strings.Cut(arg, "=")
+		if !isName(name) {
+			err = fmt.Errorf("readonly: `%s': not a valid identifier", arg)
+			continue
+		}
+		if hasValue {
+			if setErr := s.vars.Set(name, value); setErr != nil {
+				err = fmt.Errorf("readonly: %s", setErr.Error())
+				continue
+			}
+		}
+		s.vars.SetReadOnly(name)
+	}
+	return err
+}
+
+// handleUnset handles the 'unset' built-in command: "unset [-v|-f] name ..."
+func (s *Shell) handleUnset(args []string, stdout, stderr io.Writer) error {
+	functions := false
+	for len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' {
+		arg := args[0]
+		args = args[1:]
+		if arg == "--" {
+			break
+		}
+		for _, c := range arg[1:] {
+			switch c {
+			case 'v':
+				functions = false
+			case 'f':
+				functions = true
+			default:
+				return fmt.Errorf("unset: -%c: invalid option", c)
+			}
+		}
+	}
+	// The shell has no functions yet, so there is nothing to remove with -f
+	if functions {
+		return nil
+	}
+
+	var err error
+	for _, name := range args {
+		if !isName(name) {
+			err = fmt.Errorf("unset: `%s': not a valid identifier", name)
+			continue
+		}
+		if unsetErr := s.vars.Unset(name); unsetErr != nil {
+			err = fmt.Errorf("unset: %s", unsetErr.Error())
+		}
+	}
+	return err
+}
+
+// printVariables lists the variables selected by keep as commands that recreate them,
+// e.g. "export HOME=/root"
+func (s *Shell) printVariables(stdout io.Writer, command string, keep func(*Variable) bool) {
+	for _, v := range s.vars.Variables() {
+		if !keep(v) {
+			continue
+		}
+		if v.Set {
+			fmt.Fprintf(stdout, "%s %s=%s\n", command, v.Name, syntax.Quote(v.Value))
+		} else {
+			fmt.Fprintf(stdout, "%s %s\n", command, v.Name)
+		}
+	}
+}
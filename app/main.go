@@ -1,10 +1,99 @@
 package main
 
 import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/codecrafters-io/shell-starter-go/app/internal/executor"
 	"github.com/codecrafters-io/shell-starter-go/app/internal/shell"
+	"github.com/codecrafters-io/shell-starter-go/app/syntax"
 )
 
 func main() {
+	// The shell binary also prepares the sandbox for the commands it runs with -sandbox
+	if len(os.Args) > 1 && os.Args[1] == executor.SandboxInitArg {
+		executor.SandboxInit(os.Args[2:])
+	}
+
+	fmtFile := flag.String("fmt", "", "print the given script (or - for stdin) in canonical form and exit")
+	restricted := flag.Bool("r", false, "run in restricted mode")
+	auditLog := flag.String("audit-log", "", "append a JSON record of every executed command to the given file")
+	auditRedact := flag.String("audit-redact", "", "leave statements matching this regular expression out of the audit log")
+	dryRun := flag.Bool("dry-run", false, "print external commands and output redirections instead of performing them")
+	sandbox := flag.Bool("sandbox", false, "run external commands in namespaces with a read-only view of the file system and no network")
+	sandboxMounts := flag.String("sandbox-mounts", strings.Join(executor.DefaultSandboxMounts, ":"),
+		"colon-separated host paths visible read-only in the sandbox")
+	flag.Parse()
+
+	if *fmtFile != "" {
+		os.Exit(formatScript(*fmtFile, os.Stdout, os.Stderr))
+	}
+
 	sh := shell.NewShell()
+	if *sandbox {
+		var err error
+		if sh, err = shell.NewSandboxedShell(filepath.SplitList(*sandboxMounts)); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+	}
+	// Like rbash, the shell is also restricted when started under the name rsh
+	if *restricted || filepath.Base(os.Args[0]) == "rsh" {
+		sh.SetRestricted()
+	}
+	if *auditLog != "" {
+		var redact *regexp.Regexp
+		if *auditRedact != "" {
+			var err error
+			if redact, err = regexp.Compile(*auditRedact); err != nil {
+				fmt.Fprintf(os.Stderr, "audit-redact: %v\n", err)
+				os.Exit(2)
+			}
+		}
+		log, err := shell.OpenAuditLog(*auditLog, redact)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		sh.SetAuditLog(log)
+	}
+	if *dryRun {
+		sh.SetOption("dryrun", true)
+	}
+	if flag.NArg() > 0 {
+		// Arguments after the script name are not available to it yet
+		sh.RunFile(flag.Arg(0))
+	}
 	sh.Run()
 }
+
+// formatScript pretty-prints a script file and returns the process exit code
+func formatScript(path string, stdout, stderr io.Writer) int {
+	var src []byte
+	var err error
+	if path == "-" {
+		src, err = io.ReadAll(os.Stdin)
+	} else {
+		src, err = os.ReadFile(path)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "fmt: %v\n", err)
+		return 1
+	}
+
+	file, err := syntax.Parse(string(src), path)
+	if err != nil {
+		fmt.Fprintf(stderr, "%s\n", err.Error())
+		return 1
+	}
+	if err := syntax.Print(stdout, file); err != nil {
+		fmt.Fprintf(stderr, "fmt: %v\n", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,267 @@
+package syntax
+
+import "fmt"
+
+// Pos describes a position in the source text.
+// Line and Col are 1-based; Col counts runes, not bytes.
+type Pos struct {
+	Line int
+	Col  int
+}
+
+// IsValid reports whether the position was set by the parser
+func (p Pos) IsValid() bool {
+	return p.Line > 0
+}
+
+// String returns the position in "line:col" form
+func (p Pos) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Col)
+}
+
+// Node is implemented by every node of the syntax tree
+type Node interface {
+	Pos() Pos
+}
+
+// File is a parsed shell script: a list of statements in source order
+type File struct {
+	Name  string
+	Stmts []*Stmt
+	// Last holds the comments that follow the final statement
+	Last []Comment
+}
+
+// Pos returns the position of the first statement, or an invalid position for an empty file
+func (f *File) Pos() Pos {
+	if len(f.Stmts) > 0 {
+		return f.Stmts[0].Pos()
+	}
+	return Pos{}
+}
+
+// Comment is a '#' comment. Text does not include the leading '#'.
+type Comment struct {
+	Hash Pos
+	Text string
+}
+
+// Pos returns the position of the '#' character
+func (c Comment) Pos() Pos {
+	return c.Hash
+}
+
+// Stmt is a single simple command together with its redirections and comments
+type Stmt struct {
+	// Comments holds the full-line comments directly above the statement
+	Comments []Comment
+	Position Pos
+	// End is the position just after the last token of the statement
+	End    Pos
+	Cmd    *CallExpr
+	Redirs []*Redirect
+	// Time is set for statements prefixed by the time keyword
+	Time *TimeClause
+	// Coproc is set for statements prefixed by the coproc keyword
+	Coproc *CoprocClause
+	// Background is true for statements terminated by '&'
+	Background bool
+	// Trailing is the comment following the statement on the same line, if any
+	Trailing *Comment
+}
+
+// Pos returns the position of the first token of the statement
+func (s *Stmt) Pos() Pos {
+	return s.Position
+}
+
+// TimeClause is the time keyword in front of a statement, e.g. "time -p make"
+type TimeClause struct {
+	TimePos Pos
+	// PosixFormat is true for "time -p", which reports times in the POSIX format
+	PosixFormat bool
+}
+
+// Pos returns the position of the time keyword
+func (t *TimeClause) Pos() Pos {
+	return t.TimePos
+}
+
+// CoprocClause is the coproc keyword in front of a statement, e.g. "coproc cat".
+// Whether the first word of the command names the coprocess is decided when it runs.
+type CoprocClause struct {
+	CoprocPos Pos
+}
+
+// Pos returns the position of the coproc keyword
+func (c *CoprocClause) Pos() Pos {
+	return c.CoprocPos
+}
+
+// CallExpr is a command name followed by its arguments.
+// Args is empty for statements made of redirections only, e.g. "> out.txt".
+type CallExpr struct {
+	Args []*Word
+}
+
+// Pos returns the position of the command name
+func (c *CallExpr) Pos() Pos {
+	if len(c.Args) > 0 {
+		return c.Args[0].Pos()
+	}
+	return Pos{}
+}
+
+// Word is a single shell word made of adjacent literal, quoted and expansion parts,
+// e.g. foo'bar'"$baz" has three parts.
+type Word struct {
+	Parts []WordPart
+}
+
+// Pos returns the position of the first part of the word
+func (w *Word) Pos() Pos {
+	if len(w.Parts) > 0 {
+		return w.Parts[0].Pos()
+	}
+	return Pos{}
+}
+
+// WordPart is implemented by the nodes that can make up a Word
+type WordPart interface {
+	Node
+	wordPartNode()
+}
+
+// Lit is an unquoted literal. Value holds the source text verbatim, so
+// backslash escapes are kept as written.
+type Lit struct {
+	ValuePos Pos
+	Value    string
+}
+
+// Pos returns the position of the literal
+func (l *Lit) Pos() Pos {
+	return l.ValuePos
+}
+
+// SglQuoted is a single-quoted string. Value does not include the quotes.
+type SglQuoted struct {
+	Left  Pos
+	Value string
+}
+
+// Pos returns the position of the opening quote
+func (q *SglQuoted) Pos() Pos {
+	return q.Left
+}
+
+// DblQuoted is a double-quoted string. Its Lit parts keep backslash escapes as written.
+type DblQuoted struct {
+	Left  Pos
+	Parts []WordPart
+}
+
+// Pos returns the position of the opening quote
+func (q *DblQuoted) Pos() Pos {
+	return q.Left
+}
+
+// ParamExp is a parameter expansion such as $HOME, $? or ${name}
+type ParamExp struct {
+	Dollar Pos
+	// Short is true for the $name form and false for the ${name} form
+	Short bool
+	Param string
+}
+
+// Pos returns the position of the '$' character
+func (p *ParamExp) Pos() Pos {
+	return p.Dollar
+}
+
+func (*Lit) wordPartNode()       {}
+func (*SglQuoted) wordPartNode() {}
+func (*DblQuoted) wordPartNode() {}
+func (*ParamExp) wordPartNode()  {}
+
+// RedirOperator identifies the kind of a redirection
+type RedirOperator int
+
+// RdrOut is '>', AppOut is '>>', RdrIn is '<',
+// Hdoc is '<<', DashHdoc is '<<-' and ClbOut is '>|'.
+// DplOut ('>&') and DplIn ('<&') duplicate the descriptor named by the word,
+// or close the descriptor if the word is '-'.
+const (
+	RdrOut RedirOperator = iota
+	AppOut
+	RdrIn
+	Hdoc
+	DashHdoc
+	ClbOut
+	DplOut
+	DplIn
+)
+
+// String returns the operator as written in the source
+func (o RedirOperator) String() string {
+	switch o {
+	case RdrOut:
+		return ">"
+	case AppOut:
+		return ">>"
+	case RdrIn:
+		return "<"
+	case Hdoc:
+		return "<<"
+	case DashHdoc:
+		return "<<-"
+	case ClbOut:
+		return ">|"
+	case DplOut:
+		return ">&"
+	case DplIn:
+		return "<&"
+	}
+	return fmt.Sprintf("RedirOperator(%d)", int(o))
+}
+
+// DefaultFd returns the file descriptor the operator applies to when none is given
+func (o RedirOperator) DefaultFd() int {
+	switch o {
+	case RdrIn, Hdoc, DashHdoc, DplIn:
+		return 0
+	}
+	return 1
+}
+
+// Redirect is a redirection such as "2>> err.log" or a here-document
+type Redirect struct {
+	OpPos Pos
+	Op    RedirOperator
+	// N is the explicit file descriptor, e.g. "2" in "2>err", or nil if omitted
+	N *Lit
+	// Word is the redirection target, or the delimiter for here-documents
+	Word *Word
+	// Hdoc is the body of a here-document, including its final newline
+	Hdoc string
+}
+
+// Pos returns the position of the file descriptor, or of the operator if there is none
+func (r *Redirect) Pos() Pos {
+	if r.N != nil {
+		return r.N.Pos()
+	}
+	return r.OpPos
+}
+
+// Fd returns the file descriptor the redirection applies to
+func (r *Redirect) Fd() int {
+	if r.N == nil {
+		return r.Op.DefaultFd()
+	}
+	fd := 0
+	for _, c := range r.N.Value {
+		fd = fd*10 + int(c-'0')
+	}
+	return fd
+}
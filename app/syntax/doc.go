@@ -0,0 +1,20 @@
+// Package syntax implements lexing, parsing and printing of the shell language
+// understood by this shell, so that other tools can analyze the commands users type.
+//
+// Parse turns source text into a *File, Walk traverses the resulting tree and
+// Print writes it back in canonical form. NewLexer gives access to the raw
+// token stream for tools that do not need a full tree.
+//
+// # Compatibility
+//
+// The package follows semantic versioning, reported by Version. Within a major
+// version, exported identifiers are not removed or renamed and the meaning of
+// existing node fields does not change. New node types, fields, token kinds and
+// redirection operators may be added as the shell learns new syntax, so type
+// switches over nodes should have a default case. The exact output of Print may
+// change between minor versions; Print(Parse(src)) always parses back to a tree
+// with the same meaning as src.
+package syntax
+
+// Version is the semantic version of the syntax package API
+const Version = "1.7.0"
@@ -0,0 +1,508 @@
+package syntax
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TokenKind identifies the kind of a lexical token
+type TokenKind int
+
+// Token kinds produced by the Lexer
+const (
+	EOFToken TokenKind = iota
+	WordToken
+	NewlineToken
+	SemicolonToken
+	AmpersandToken
+	RedirectToken
+	CommentToken
+)
+
+// String returns a human readable name for the token kind
+func (k TokenKind) String() string {
+	switch k {
+	case EOFToken:
+		return "end of file"
+	case WordToken:
+		return "word"
+	case NewlineToken:
+		return "newline"
+	case SemicolonToken:
+		return "';'"
+	case AmpersandToken:
+		return "'&'"
+	case RedirectToken:
+		return "redirection"
+	case CommentToken:
+		return "comment"
+	}
+	return fmt.Sprintf("TokenKind(%d)", int(k))
+}
+
+// Token is a single lexical token.
+// Word is set for WordToken, Redirect (without its target) for RedirectToken
+// and Text (without the '#') for CommentToken.
+type Token struct {
+	Kind     TokenKind
+	Pos      Pos
+	End      Pos
+	Word     *Word
+	Redirect *Redirect
+	Text     string
+}
+
+// Lexer splits shell source text into tokens
+type Lexer struct {
+	name  string
+	src   []rune
+	off   int
+	line  int
+	col   int
+	hdocs []*Redirect
+}
+
+// NewLexer creates a lexer for src. The name is only used in error messages.
+func NewLexer(src, name string) *Lexer {
+	return &Lexer{
+		name: name,
+		src:  []rune(src),
+		line: 1,
+		col:  1,
+	}
+}
+
+// isBlank reports whether c separates words
+func isBlank(c rune) bool {
+	return c == ' ' || c == '\t'
+}
+
+// isMeta reports whether c ends an unquoted word
+func isMeta(c rune) bool {
+	switch c {
+	case ' ', '\t', '\n', ';', '&', '|', '<', '>', '(', ')':
+		return true
+	}
+	return false
+}
+
+// isNameStart reports whether c can start a variable name
+func isNameStart(c rune) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// isNameChar reports whether c can appear in a variable name
+func isNameChar(c rune) bool {
+	return isNameStart(c) || (c >= '0' && c <= '9')
+}
+
+// isSpecialParam reports whether c names a special parameter such as $? or $1
+func isSpecialParam(c rune) bool {
+	return strings.ContainsRune("?$!#@*-", c) || (c >= '0' && c <= '9')
+}
+
+// pos returns the current position
+func (l *Lexer) pos() Pos {
+	return Pos{Line: l.line, Col: l.col}
+}
+
+// peek returns the rune at offset n from the current one, or 0 past the end
+func (l *Lexer) peek(n int) rune {
+	if l.off+n < len(l.src) {
+		return l.src[l.off+n]
+	}
+	return 0
+}
+
+// atEOF reports whether the whole input has been consumed
+func (l *Lexer) atEOF() bool {
+	return l.off >= len(l.src)
+}
+
+// advance consumes one rune and returns it
+func (l *Lexer) advance() rune {
+	c := l.src[l.off]
+	l.off++
+	if c == '\n' {
+		l.line++
+		l.col = 1
+	} else {
+		l.col++
+	}
+	return c
+}
+
+// ParseError is returned by the Lexer and by Parse for malformed input
+type ParseError struct {
+	Filename string
+	Pos      Pos
+	Text     string
+	// Incomplete is set when the input ended while a here-document was still open,
+	// so that more input, such as the next lines typed at a prompt, can complete it
+	Incomplete bool
+}
+
+func (e ParseError) Error() string {
+	if e.Filename != "" {
+		return fmt.Sprintf("parse error: %s:%s: %s", e.Filename, e.Pos, e.Text)
+	}
+	return fmt.Sprintf("parse error: %s: %s", e.Pos, e.Text)
+}
+
+// errorf creates a parse error that points at pos
+func (l *Lexer) errorf(pos Pos, format string, args ...any) error {
+	return ParseError{Filename: l.name, Pos: pos, Text: fmt.Sprintf(format, args...)}
+}
+
+// incompletef creates a parse error for input that ended too early
+func (l *Lexer) incompletef(pos Pos, format string, args ...any) error {
+	return ParseError{Filename: l.name, Pos: pos, Text: fmt.Sprintf(format, args...), Incomplete: true}
+}
+
+// AddHeredoc registers a here-document whose body starts after the next newline.
+// The parser calls it once it has read the delimiter word of a '<<' redirection.
+func (l *Lexer) AddHeredoc(r *Redirect) {
+	l.hdocs = append(l.hdocs, r)
+}
+
+// Next returns the next token
+func (l *Lexer) Next() (Token, error) {
+	for !l.atEOF() {
+		c := l.peek(0)
+		if isBlank(c) {
+			l.advance()
+		} else if c == '\\' && l.peek(1) == '\n' {
+			l.advance()
+			l.advance()
+		} else {
+			break
+		}
+	}
+
+	start := l.pos()
+	if l.atEOF() {
+		if len(l.hdocs) > 0 {
+			return Token{}, l.incompletef(start, "here-document delimited by end of file")
+		}
+		return Token{Kind: EOFToken, Pos: start, End: start}, nil
+	}
+
+	switch c := l.peek(0); c {
+	case '\n':
+		l.advance()
+		if err := l.readHeredocs(); err != nil {
+			return Token{}, err
+		}
+		return Token{Kind: NewlineToken, Pos: start, End: l.pos()}, nil
+	case ';':
+		l.advance()
+		return Token{Kind: SemicolonToken, Pos: start, End: l.pos()}, nil
+	case '#':
+		l.advance()
+		var text strings.Builder
+		for !l.atEOF() && l.peek(0) != '\n' {
+			text.WriteRune(l.advance())
+		}
+		return Token{Kind: CommentToken, Pos: start, End: l.pos(), Text: text.String()}, nil
+	case '<', '>':
+		return l.readRedirect(nil)
+	case '&':
+		if l.peek(1) == '&' {
+			return Token{}, l.errorf(start, "unsupported operator %q", "&&")
+		}
+		l.advance()
+		return Token{Kind: AmpersandToken, Pos: start, End: l.pos()}, nil
+	case '|', '(', ')':
+		return Token{}, l.errorf(start, "unsupported operator %q", string(c))
+	}
+
+	word, err := l.readWord()
+	if err != nil {
+		return Token{}, err
+	}
+
+	// A run of digits glued to a redirection operator is its file descriptor, e.g. "2>"
+	if c := l.peek(0); c == '<' || c == '>' {
+		if lit, ok := fdLiteral(word); ok {
+			return l.readRedirect(lit)
+		}
+	}
+
+	return Token{Kind: WordToken, Pos: start, End: l.pos(), Word: word}, nil
+}
+
+// fdLiteral returns the word as a literal if it consists of decimal digits only
+func fdLiteral(w *Word) (*Lit, bool) {
+	if len(w.Parts) != 1 {
+		return nil, false
+	}
+	lit, ok := w.Parts[0].(*Lit)
+	if !ok || lit.Value == "" {
+		return nil, false
+	}
+	for _, c := range lit.Value {
+		if c < '0' || c > '9' {
+			return nil, false
+		}
+	}
+	return lit, true
+}
+
+// readRedirect reads a redirection operator, with n as its explicit file descriptor
+func (l *Lexer) readRedirect(n *Lit) (Token, error) {
+	start := l.pos()
+	r := &Redirect{OpPos: start, N: n}
+
+	if l.advance() == '>' {
+		r.Op = RdrOut
+		switch l.peek(0) {
+		case '>':
+			l.advance()
+			r.Op = AppOut
+		case '|':
+			l.advance()
+			r.Op = ClbOut
+		case '&':
+			l.advance()
+			r.Op = DplOut
+		}
+	} else {
+		r.Op = RdrIn
+		if l.peek(0) == '&' {
+			l.advance()
+			r.Op = DplIn
+		} else if l.peek(0) == '<' {
+			l.advance()
+			r.Op = Hdoc
+			if l.peek(0) == '-' {
+				l.advance()
+				r.Op = DashHdoc
+			}
+		}
+	}
+
+	tokPos := start
+	if n != nil {
+		tokPos = n.Pos()
+	}
+	return Token{Kind: RedirectToken, Pos: tokPos, End: l.pos(), Redirect: r}, nil
+}
+
+// readWord reads an unquoted word made of literal, quoted and expansion parts
+func (l *Lexer) readWord() (*Word, error) {
+	word := &Word{}
+	var lit strings.Builder
+	litPos := l.pos()
+
+	flush := func() {
+		if lit.Len() > 0 {
+			word.Parts = append(word.Parts, &Lit{ValuePos: litPos, Value: lit.String()})
+			lit.Reset()
+		}
+	}
+
+	for !l.atEOF() && !isMeta(l.peek(0)) {
+		switch c := l.peek(0); c {
+		case '\\':
+			if l.peek(1) == '\n' {
+				l.advance()
+				l.advance()
+				continue
+			}
+			if lit.Len() == 0 {
+				litPos = l.pos()
+			}
+			lit.WriteRune(l.advance())
+			if !l.atEOF() {
+				lit.WriteRune(l.advance())
+			}
+		case '\'':
+			flush()
+			part, err := l.readSglQuoted()
+			if err != nil {
+				return nil, err
+			}
+			word.Parts = append(word.Parts, part)
+		case '"':
+			flush()
+			part, err := l.readDblQuoted()
+			if err != nil {
+				return nil, err
+			}
+			word.Parts = append(word.Parts, part)
+		case '$':
+			if part, ok := l.readParamExp(); ok {
+				flush()
+				word.Parts = append(word.Parts, part)
+				continue
+			}
+			if lit.Len() == 0 {
+				litPos = l.pos()
+			}
+			lit.WriteRune(l.advance())
+		default:
+			if lit.Len() == 0 {
+				litPos = l.pos()
+			}
+			lit.WriteRune(l.advance())
+		}
+	}
+	flush()
+
+	return word, nil
+}
+
+// readSglQuoted reads a single-quoted string, including both quotes
+func (l *Lexer) readSglQuoted() (*SglQuoted, error) {
+	left := l.pos()
+	l.advance()
+
+	var value strings.Builder
+	for {
+		if l.atEOF() {
+			return nil, l.errorf(left, "unterminated single-quoted string")
+		}
+		c := l.advance()
+		if c == '\'' {
+			break
+		}
+		value.WriteRune(c)
+	}
+	return &SglQuoted{Left: left, Value: value.String()}, nil
+}
+
+// readDblQuoted reads a double-quoted string, including both quotes
+func (l *Lexer) readDblQuoted() (*DblQuoted, error) {
+	left := l.pos()
+	l.advance()
+
+	quoted := &DblQuoted{Left: left}
+	if err := l.readDblQuotedParts(quoted, true); err != nil {
+		return nil, err
+	}
+	return quoted, nil
+}
+
+// readDblQuotedParts reads the contents of a double-quoted string into quoted.
+// If closed is set, the string ends at an unescaped '"', which is consumed;
+// otherwise it runs to the end of the source and '"' is an ordinary character.
+func (l *Lexer) readDblQuotedParts(quoted *DblQuoted, closed bool) error {
+	var lit strings.Builder
+	litPos := l.pos()
+
+	flush := func() {
+		if lit.Len() > 0 {
+			quoted.Parts = append(quoted.Parts, &Lit{ValuePos: litPos, Value: lit.String()})
+			lit.Reset()
+		}
+	}
+
+	for {
+		if l.atEOF() {
+			if closed {
+				return l.errorf(quoted.Left, "unterminated double-quoted string")
+			}
+			break
+		}
+		c := l.peek(0)
+		if c == '"' && closed {
+			l.advance()
+			break
+		}
+		if c == '\\' && l.peek(1) == '\n' {
+			l.advance()
+			l.advance()
+			continue
+		}
+		if c == '$' {
+			if part, ok := l.readParamExp(); ok {
+				flush()
+				quoted.Parts = append(quoted.Parts, part)
+				continue
+			}
+		}
+		if lit.Len() == 0 {
+			litPos = l.pos()
+		}
+		lit.WriteRune(l.advance())
+		if c == '\\' && !l.atEOF() {
+			lit.WriteRune(l.advance())
+		}
+	}
+	flush()
+	return nil
+}
+
+// readParamExp reads a parameter expansion starting at '$'.
+// It returns false, consuming nothing, if the '$' does not start an expansion.
+func (l *Lexer) readParamExp() (*ParamExp, bool) {
+	dollar := l.pos()
+	next := l.peek(1)
+
+	switch {
+	case next == '{':
+		end := -1
+		for i := l.off + 2; i < len(l.src) && l.src[i] != '\n'; i++ {
+			if l.src[i] == '}' {
+				end = i
+				break
+			}
+		}
+		if end < 0 {
+			return nil, false
+		}
+		param := string(l.src[l.off+2 : end])
+		for l.off <= end {
+			l.advance()
+		}
+		return &ParamExp{Dollar: dollar, Param: param}, true
+	case isNameStart(next):
+		l.advance()
+		var name strings.Builder
+		for !l.atEOF() && isNameChar(l.peek(0)) {
+			name.WriteRune(l.advance())
+		}
+		return &ParamExp{Dollar: dollar, Short: true, Param: name.String()}, true
+	case isSpecialParam(next):
+		l.advance()
+		return &ParamExp{Dollar: dollar, Short: true, Param: string(l.advance())}, true
+	}
+	return nil, false
+}
+
+// readHeredocs reads the bodies of the pending here-documents.
+// It is called right after the newline that ends the line holding their operators.
+func (l *Lexer) readHeredocs() error {
+	for _, r := range l.hdocs {
+		delim, _ := r.Word.Literal()
+		start := l.pos()
+
+		var body strings.Builder
+		for {
+			if l.atEOF() {
+				return l.incompletef(start, "here-document delimited by end of file (wanted %q)", delim)
+			}
+			var line strings.Builder
+			for !l.atEOF() && l.peek(0) != '\n' {
+				line.WriteRune(l.advance())
+			}
+			if !l.atEOF() {
+				l.advance()
+			}
+
+			text := line.String()
+			check := text
+			if r.Op == DashHdoc {
+				check = strings.TrimLeft(text, "\t")
+			}
+			if check == delim {
+				break
+			}
+			body.WriteString(text)
+			body.WriteByte('\n')
+		}
+		r.Hdoc = body.String()
+	}
+	l.hdocs = nil
+	return nil
+}
@@ -0,0 +1,214 @@
+package syntax
+
+import (
+	"strings"
+)
+
+// scriptParser builds a File from the tokens produced by a Lexer
+type scriptParser struct {
+	lexer *Lexer
+	file  *File
+	tok   Token
+
+	// pending holds full-line comments not yet attached to a statement
+	pending []Comment
+	// stmt is the statement being built, or nil between statements
+	stmt *Stmt
+	// last is the most recently completed statement on the current line
+	last *Stmt
+}
+
+// Parse parses a complete shell script into a syntax tree.
+// The name is recorded in the File and used in error messages.
+func Parse(src, name string) (*File, error) {
+	p := &scriptParser{
+		lexer: NewLexer(src, name),
+		file:  &File{Name: name},
+	}
+	if err := p.parse(); err != nil {
+		return nil, err
+	}
+	return p.file, nil
+}
+
+// ParseQuoted parses src as the contents of a double-quoted string, in which only
+// parameter expansions and backslash escapes are special, as shells do for prompt
+// strings such as PS4. The result never fails to parse: a '"' in src is literal.
+func ParseQuoted(src string) *DblQuoted {
+	l := NewLexer(src, "")
+	quoted := &DblQuoted{Left: l.pos()}
+	l.readDblQuotedParts(quoted, false)
+	return quoted
+}
+
+// next advances to the next token
+func (p *scriptParser) next() error {
+	tok, err := p.lexer.Next()
+	if err != nil {
+		return err
+	}
+	p.tok = tok
+	return nil
+}
+
+// parse consumes all tokens, building the file's statements
+func (p *scriptParser) parse() error {
+	for {
+		if err := p.next(); err != nil {
+			return err
+		}
+
+		switch p.tok.Kind {
+		case EOFToken:
+			p.endStmt()
+			p.file.Last = p.pending
+			return nil
+		case NewlineToken:
+			p.endStmt()
+			p.last = nil
+		case SemicolonToken, AmpersandToken:
+			if p.stmt == nil {
+				return p.lexer.errorf(p.tok.Pos, "unexpected %s", p.tok.Kind)
+			}
+			p.stmt.Background = p.tok.Kind == AmpersandToken
+			p.stmt.End = p.tok.End
+			p.endStmt()
+		case CommentToken:
+			comment := Comment{Hash: p.tok.Pos, Text: p.tok.Text}
+			if p.stmt != nil {
+				p.stmt.Trailing = &comment
+				p.endStmt()
+			} else if p.last != nil {
+				p.last.Trailing = &comment
+			} else {
+				p.pending = append(p.pending, comment)
+			}
+		case WordToken:
+			newStmt := p.stmt == nil
+			stmt := p.startStmt()
+			stmt.End = p.tok.End
+			switch {
+			case newStmt && isKeyword(p.tok.Word, "time"):
+				stmt.Time = &TimeClause{TimePos: p.tok.Pos}
+			case newStmt && isKeyword(p.tok.Word, "coproc"):
+				stmt.Coproc = &CoprocClause{CoprocPos: p.tok.Pos}
+			case p.isTimeOption():
+				stmt.Time.PosixFormat = true
+			default:
+				stmt.Cmd.Args = append(stmt.Cmd.Args, p.tok.Word)
+			}
+		case RedirectToken:
+			if err := p.parseRedirect(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// isKeyword reports whether a word is the unquoted reserved word kw
+func isKeyword(w *Word, kw string) bool {
+	if len(w.Parts) != 1 {
+		return false
+	}
+	lit, ok := w.Parts[0].(*Lit)
+	return ok && lit.Value == kw
+}
+
+// isTimeOption reports whether the current word is the -p option of a time keyword
+func (p *scriptParser) isTimeOption() bool {
+	stmt := p.stmt
+	return stmt.Time != nil && !stmt.Time.PosixFormat && len(stmt.Cmd.Args) == 0 &&
+		len(stmt.Redirs) == 0 && isKeyword(p.tok.Word, "-p")
+}
+
+// startStmt returns the statement being built, starting a new one if needed
+func (p *scriptParser) startStmt() *Stmt {
+	if p.stmt == nil {
+		p.stmt = &Stmt{
+			Comments: p.pending,
+			Position: p.tok.Pos,
+			Cmd:      &CallExpr{},
+		}
+		p.pending = nil
+	}
+	return p.stmt
+}
+
+// endStmt completes the statement being built, if any
+func (p *scriptParser) endStmt() {
+	if p.stmt != nil {
+		p.file.Stmts = append(p.file.Stmts, p.stmt)
+		p.last = p.stmt
+		p.stmt = nil
+	}
+}
+
+// parseRedirect reads the target word of the current redirection token
+func (p *scriptParser) parseRedirect() error {
+	stmt := p.startStmt()
+	redir := p.tok.Redirect
+	opPos := p.tok.Pos
+
+	if err := p.next(); err != nil {
+		return err
+	}
+	if p.tok.Kind != WordToken {
+		return p.lexer.errorf(opPos, "missing filename for redirection %s", redir.Op)
+	}
+	redir.Word = p.tok.Word
+
+	if redir.Op == Hdoc || redir.Op == DashHdoc {
+		if _, ok := redir.Word.Literal(); !ok {
+			return p.lexer.errorf(opPos, "here-document delimiter must not contain expansions")
+		}
+		p.lexer.AddHeredoc(redir)
+	}
+
+	stmt.Redirs = append(stmt.Redirs, redir)
+	stmt.End = p.tok.End
+	return nil
+}
+
+// Literal returns the value of the word with quotes and escapes removed.
+// It returns false if the word contains expansions.
+func (w *Word) Literal() (string, bool) {
+	var value strings.Builder
+	for _, part := range w.Parts {
+		switch part := part.(type) {
+		case *Lit:
+			value.WriteString(Unescape(part.Value, false))
+		case *SglQuoted:
+			value.WriteString(part.Value)
+		case *DblQuoted:
+			for _, inner := range part.Parts {
+				lit, ok := inner.(*Lit)
+				if !ok {
+					return "", false
+				}
+				value.WriteString(Unescape(lit.Value, true))
+			}
+		default:
+			return "", false
+		}
+	}
+	return value.String(), true
+}
+
+// Unescape removes backslash escapes from the Value of a Lit.
+// Inside double quotes (dquoted), a backslash is only removed before
+// one of the characters $ ` " and \, as the shell does.
+func Unescape(raw string, dquoted bool) string {
+	if !strings.ContainsRune(raw, '\\') {
+		return raw
+	}
+
+	var out strings.Builder
+	runes := []rune(raw)
+	for i := 0; i < len(runes); i++ {
+		if runes[i] == '\\' && i+1 < len(runes) && (!dquoted || strings.ContainsRune("$`\"\\", runes[i+1])) {
+			i++
+		}
+		out.WriteRune(runes[i])
+	}
+	return out.String()
+}
@@ -0,0 +1,239 @@
+package syntax
+
+import (
+	"bytes"
+	"io"
+	"strings"
+)
+
+// Print writes the file to w in canonical form: one statement per line,
+// redirections after the arguments with default file descriptors omitted,
+// single blank lines preserved between paragraphs and comments kept next
+// to the statements they belong to.
+func Print(w io.Writer, f *File) error {
+	var buf bytes.Buffer
+	lastLine := 0
+
+	separate := func(line int) {
+		if lastLine > 0 && line > lastLine+1 {
+			buf.WriteByte('\n')
+		}
+	}
+
+	for _, stmt := range f.Stmts {
+		for _, c := range stmt.Comments {
+			separate(c.Hash.Line)
+			printComment(&buf, c)
+			buf.WriteByte('\n')
+			lastLine = c.Hash.Line
+		}
+		separate(stmt.Position.Line)
+		printStmt(&buf, stmt)
+		lastLine = stmtLastLine(stmt)
+	}
+
+	for _, c := range f.Last {
+		separate(c.Hash.Line)
+		printComment(&buf, c)
+		buf.WriteByte('\n')
+		lastLine = c.Hash.Line
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// stmtLastLine returns the last source line occupied by a statement,
+// including the bodies and closing delimiters of its here-documents
+func stmtLastLine(stmt *Stmt) int {
+	line := stmt.End.Line
+	for _, r := range stmt.Redirs {
+		if r.Op == Hdoc || r.Op == DashHdoc {
+			line += strings.Count(r.Hdoc, "\n") + 1
+		}
+	}
+	return line
+}
+
+// printComment writes a comment without a trailing newline
+func printComment(buf *bytes.Buffer, c Comment) {
+	buf.WriteByte('#')
+	buf.WriteString(strings.TrimRight(c.Text, " \t"))
+}
+
+// printStmt writes a statement followed by a newline and its here-document bodies
+func printStmt(buf *bytes.Buffer, stmt *Stmt) {
+	var fields []string
+	if stmt.Time != nil {
+		fields = append(fields, "time")
+		if stmt.Time.PosixFormat {
+			fields = append(fields, "-p")
+		}
+	}
+	if stmt.Coproc != nil {
+		fields = append(fields, "coproc")
+	}
+	for i, arg := range stmt.Cmd.Args {
+		word := printWord(arg)
+		if i == 0 && isReserved(stmt, word) {
+			// Keep a quoted command name from being read back as a keyword
+			word = "'" + word + "'"
+		}
+		fields = append(fields, word)
+	}
+	for _, r := range stmt.Redirs {
+		fields = append(fields, printRedirect(r))
+	}
+	if stmt.Background {
+		fields = append(fields, "&")
+	}
+	buf.WriteString(strings.Join(fields, " "))
+
+	if stmt.Trailing != nil {
+		buf.WriteByte(' ')
+		printComment(buf, *stmt.Trailing)
+	}
+	buf.WriteByte('\n')
+
+	for _, r := range stmt.Redirs {
+		if r.Op == Hdoc || r.Op == DashHdoc {
+			delim, _ := r.Word.Literal()
+			buf.WriteString(r.Hdoc)
+			buf.WriteString(delim)
+			buf.WriteByte('\n')
+		}
+	}
+}
+
+// isReserved reports whether word would be read as a keyword at the start of the statement's command
+func isReserved(stmt *Stmt, word string) bool {
+	switch {
+	case stmt.Coproc != nil:
+		return false
+	case stmt.Time == nil:
+		return word == "time" || word == "coproc"
+	case !stmt.Time.PosixFormat:
+		return word == "-p"
+	}
+	return false
+}
+
+// printRedirect formats a redirection, omitting the file descriptor when it is the default
+func printRedirect(r *Redirect) string {
+	var sb strings.Builder
+	if fd := r.Fd(); fd != r.Op.DefaultFd() {
+		sb.WriteString(r.N.Value)
+	}
+	sb.WriteString(r.Op.String())
+	if r.Op == Hdoc || r.Op == DashHdoc {
+		// Quoting of the delimiter controls expansion in the body, so keep it as written
+		sb.WriteString(printWordParts(r.Word.Parts))
+	} else {
+		sb.WriteString(printWord(r.Word))
+	}
+	return sb.String()
+}
+
+// printWord formats a word. Words made only of quoted text are requoted
+// canonically: bare if no quoting is needed, single quotes if possible,
+// double quotes otherwise. Any other word is printed as written.
+func printWord(w *Word) string {
+	if value, ok := w.Literal(); ok && allQuoted(w) {
+		return Quote(value)
+	}
+	return printWordParts(w.Parts)
+}
+
+// allQuoted reports whether every part of the word is quoted
+func allQuoted(w *Word) bool {
+	for _, part := range w.Parts {
+		switch part.(type) {
+		case *SglQuoted, *DblQuoted:
+		default:
+			return false
+		}
+	}
+	return len(w.Parts) > 0
+}
+
+// printWordParts formats word parts exactly as they were written
+func printWordParts(parts []WordPart) string {
+	var sb strings.Builder
+	for _, part := range parts {
+		switch part := part.(type) {
+		case *Lit:
+			sb.WriteString(part.Value)
+		case *SglQuoted:
+			sb.WriteByte('\'')
+			sb.WriteString(part.Value)
+			sb.WriteByte('\'')
+		case *DblQuoted:
+			sb.WriteByte('"')
+			sb.WriteString(printWordParts(part.Parts))
+			sb.WriteByte('"')
+		case *ParamExp:
+			sb.WriteByte('$')
+			if part.Short {
+				sb.WriteString(part.Param)
+			} else {
+				sb.WriteString("{" + part.Param + "}")
+			}
+		}
+	}
+	return sb.String()
+}
+
+// Quote returns value quoted so that the shell reads it back as a single literal word
+func Quote(value string) string {
+	if value == "" {
+		return "''"
+	}
+	if !needsQuoting(value) {
+		return value
+	}
+	if !strings.ContainsRune(value, '\'') {
+		return "'" + value + "'"
+	}
+
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for _, c := range value {
+		if strings.ContainsRune("$`\"\\", c) {
+			sb.WriteByte('\\')
+		}
+		sb.WriteRune(c)
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
+
+// needsQuoting reports whether value would not be read back literally when written bare
+func needsQuoting(value string) bool {
+	for _, c := range value {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case strings.ContainsRune("_-./,:@%+", c):
+		case c == '=':
+			// Quote words that would otherwise be read as an assignment
+			if i := strings.IndexRune(value, '='); i > 0 && isName(value[:i]) {
+				return true
+			}
+		default:
+			return true
+		}
+	}
+	return false
+}
+
+// isName reports whether s is a valid variable name
+func isName(s string) bool {
+	if s == "" || !isNameStart(rune(s[0])) {
+		return false
+	}
+	for _, c := range s {
+		if !isNameChar(c) {
+			return false
+		}
+	}
+	return true
+}
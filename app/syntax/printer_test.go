@@ -0,0 +1,335 @@
+package syntax
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// printString parses src and prints it back in canonical form
+func printString(t *testing.T, src string) string {
+	t.Helper()
+	file, err := Parse(src, "")
+	if err != nil {
+		t.Fatalf("Parse(%q) error: %v", src, err)
+	}
+	var buf bytes.Buffer
+	if err := Print(&buf, file); err != nil {
+		t.Fatalf("Print() error: %v", err)
+	}
+	return buf.String()
+}
+
+// flatten describes what a file does, ignoring how it was written:
+// the literal value of every argument and the effective target of every redirection
+func flatten(t *testing.T, f *File) []string {
+	t.Helper()
+	var out []string
+	for _, stmt := range f.Stmts {
+		var fields []string
+		if stmt.Time != nil {
+			fields = append(fields, fmt.Sprintf("time posix=%t", stmt.Time.PosixFormat))
+		}
+		if stmt.Coproc != nil {
+			fields = append(fields, "coproc")
+		}
+		for _, arg := range stmt.Cmd.Args {
+			value, ok := arg.Literal()
+			if !ok {
+				value = "expansion:" + printWordParts(arg.Parts)
+			}
+			fields = append(fields, value)
+		}
+		for _, r := range stmt.Redirs {
+			target, _ := r.Word.Literal()
+			fields = append(fields, fmt.Sprintf("%d%s%s|%s", r.Fd(), r.Op, target, r.Hdoc))
+		}
+		if stmt.Background {
+			fields = append(fields, "&")
+		}
+		out = append(out, strings.Join(fields, "\x00"))
+	}
+	return out
+}
+
+func TestPrint(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "empty script",
+			input:    "",
+			expected: "",
+		},
+		{
+			name:     "extra blanks collapse",
+			input:    "   echo    hello   world   \n",
+			expected: "echo hello world\n",
+		},
+		{
+			name:     "missing final newline is added",
+			input:    "pwd",
+			expected: "pwd\n",
+		},
+		{
+			name:     "semicolons become newlines",
+			input:    "cd /tmp; pwd;echo done",
+			expected: "cd /tmp\npwd\necho done\n",
+		},
+		{
+			name:     "redundant quotes are removed",
+			input:    "echo \"hello\" 'world'",
+			expected: "echo hello world\n",
+		},
+		{
+			name:     "double quotes become single quotes",
+			input:    "echo \"hello world\"",
+			expected: "echo 'hello world'\n",
+		},
+		{
+			name:     "single quote inside value keeps double quotes",
+			input:    "echo \"it's\"",
+			expected: "echo \"it's\"\n",
+		},
+		{
+			name:     "adjacent quoted parts are merged",
+			input:    "echo 'hello'\"world\"",
+			expected: "echo helloworld\n",
+		},
+		{
+			name:     "empty quotes are normalized",
+			input:    "echo \"\"",
+			expected: "echo ''\n",
+		},
+		{
+			name:     "unquoted text is kept as written",
+			input:    "echo a\\ b *.go",
+			expected: "echo a\\ b *.go\n",
+		},
+		{
+			name:     "expansions are kept as written",
+			input:    "echo \"$HOME/bin\" ${USER}",
+			expected: "echo \"$HOME/bin\" ${USER}\n",
+		},
+		{
+			name:     "redirections are normalized and moved last",
+			input:    "echo 1> out.txt hello 2 >> log",
+			expected: "echo hello 2 >out.txt >>log\n",
+		},
+		{
+			name:     "stderr redirection keeps its descriptor",
+			input:    "ls /missing 2>  \"err file.txt\"",
+			expected: "ls /missing 2>'err file.txt'\n",
+		},
+		{
+			name:     "clobber redirection is kept",
+			input:    "echo hi >|  out.txt",
+			expected: "echo hi >|out.txt\n",
+		},
+		{
+			name:     "background statements keep their ampersand",
+			input:    "sleep 10&echo started",
+			expected: "sleep 10 &\necho started\n",
+		},
+		{
+			name:     "comments stay attached",
+			input:    "# setup\ncd /tmp   # go there\n\n\n# done\n",
+			expected: "# setup\ncd /tmp # go there\n\n# done\n",
+		},
+		{
+			name:     "blank lines between paragraphs are kept once",
+			input:    "echo a\n\n\n\necho b\necho c\n",
+			expected: "echo a\n\necho b\necho c\n",
+		},
+		{
+			name:     "line continuations are joined",
+			input:    "echo one \\\n  two\n",
+			expected: "echo one two\n",
+		},
+		{
+			name:     "here-documents are preserved",
+			input:    "cat <<EOF > out.txt\n  indented $HOME\nEOF\necho after\n",
+			expected: "cat <<EOF >out.txt\n  indented $HOME\nEOF\necho after\n",
+		},
+		{
+			name:     "quoted here-document delimiter is kept",
+			input:    "cat << 'END'\n$literal\nEND\n",
+			expected: "cat <<'END'\n$literal\nEND\n",
+		},
+		{
+			name:     "words that look like assignments stay quoted",
+			input:    "echo 'A=b' \"--opt=val\"",
+			expected: "echo 'A=b' --opt=val\n",
+		},
+		{
+			name:     "descriptor duplication",
+			input:    "cmd 2>&1 1>&2 0<&3 3>& -",
+			expected: "cmd 2>&1 >&2 <&3 3>&-\n",
+		},
+		{
+			name:     "time keyword and its option",
+			input:    "time   -p  make  all",
+			expected: "time -p make all\n",
+		},
+		{
+			name:     "quoted time stays a command",
+			input:    "'time' ls\n> out time ls\ntime '-p' x",
+			expected: "'time' ls\n'time' ls >out\ntime '-p' x\n",
+		},
+		{
+			name:     "coproc keyword",
+			input:    "coproc  CAT cat 2>/dev/null\n'coproc' x\ncoproc coproc",
+			expected: "coproc CAT cat 2>/dev/null\n'coproc' x\ncoproc coproc\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := printString(t, tt.input)
+			if got != tt.expected {
+				t.Errorf("Print() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		// incomplete is set for input that more lines could complete
+		incomplete bool
+	}{
+		{name: "missing redirection target", input: "echo hello >"},
+		{name: "unterminated single quote", input: "echo 'hello"},
+		{name: "unterminated double quote", input: "echo \"hello"},
+		{name: "unterminated here-document", input: "cat <<EOF\nbody\n", incomplete: true},
+		{name: "here-document without body", input: "cat <<EOF", incomplete: true},
+		{name: "leading semicolon", input: "; echo"},
+		{name: "pipeline", input: "ls | wc -l"},
+		{name: "and list", input: "true && false"},
+		{name: "lone ampersand", input: "&"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.input, "")
+			if err == nil {
+				t.Fatalf("Parse(%q) expected an error", tt.input)
+			}
+			if parseErr, ok := err.(ParseError); !ok || parseErr.Incomplete != tt.incomplete {
+				t.Errorf("Parse(%q) error = %#v, want Incomplete %v", tt.input, err, tt.incomplete)
+			}
+		})
+	}
+}
+
+// roundTrip checks that printing is idempotent and does not change what the script does
+func roundTrip(t *testing.T, src string) {
+	t.Helper()
+	original, err := Parse(src, "")
+	if err != nil {
+		t.Fatalf("Parse(%q) error: %v", src, err)
+	}
+
+	var first bytes.Buffer
+	Print(&first, original)
+	reparsed, err := Parse(first.String(), "")
+	if err != nil {
+		t.Fatalf("Parse(Print(%q)) error: %v\nprinted: %q", src, err, first.String())
+	}
+	if !reflect.DeepEqual(flatten(t, original), flatten(t, reparsed)) {
+		t.Fatalf("printing changed meaning of %q\nprinted: %q\nbefore: %q\nafter:  %q",
+			src, first.String(), flatten(t, original), flatten(t, reparsed))
+	}
+
+	var second bytes.Buffer
+	Print(&second, reparsed)
+	if first.String() != second.String() {
+		t.Fatalf("printing is not idempotent for %q\nfirst:  %q\nsecond: %q", src, first.String(), second.String())
+	}
+}
+
+func TestPrintRoundTrip(t *testing.T) {
+	corpus := []string{
+		"echo hello world",
+		"echo 'a b' \"c d\" e\\ f",
+		"echo \"it's\" 'say \"hi\"' \"back\\\\slash\" \"\\$HOME\"",
+		"ls -l /tmp > out.txt 2>> err.txt",
+		"cat < in.txt",
+		"exec 3> log 2>&1 4<&0 3>&-",
+		"# comment only",
+		"echo a # trailing\n\n# leading\necho b",
+		"cat <<-EOF\n\tindented\n\tEOF\necho next",
+		"echo $HOME ${PATH} \"$?\"",
+		"sleep 1 & sleep 2 &",
+		"time sleep 1; time -p ls > out; time",
+		"coproc cat; coproc 'coproc' x; echo coproc",
+		"echo '' \"\" ''''",
+	}
+	for _, src := range corpus {
+		roundTrip(t, src)
+	}
+}
+
+// randomWord builds a word from random characters with random quoting
+func randomWord(r *rand.Rand) string {
+	const chars = "ab z$'\"\\*~#=-./;>"
+	var sb strings.Builder
+	for n := r.Intn(4) + 1; n > 0; n-- {
+		var value strings.Builder
+		for m := r.Intn(5); m > 0; m-- {
+			value.WriteByte(chars[r.Intn(len(chars))])
+		}
+		v := value.String()
+		switch r.Intn(3) {
+		case 0:
+			sb.WriteString("'" + strings.ReplaceAll(v, "'", "") + "'")
+		case 1:
+			sb.WriteString(Quote(v))
+		default:
+			escaped := strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "$", "\\$", "`", "\\`").Replace(v)
+			sb.WriteString("\"" + escaped + "\"")
+		}
+	}
+	return sb.String()
+}
+
+func TestPrintRoundTripRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	ops := []string{">", ">>", "<", "2>", "2>>", ">|"}
+
+	for i := 0; i < 500; i++ {
+		var fields []string
+		for n := r.Intn(5) + 1; n > 0; n-- {
+			fields = append(fields, randomWord(r))
+		}
+		if r.Intn(2) == 0 {
+			fields = append(fields, ops[r.Intn(len(ops))]+" "+randomWord(r))
+		}
+		roundTrip(t, strings.Join(fields, " "))
+	}
+}
+
+func TestParseQuoted(t *testing.T) {
+	quoted := ParseQuoted(`+$LINENO "x" \$y ${z}`)
+
+	var got []string
+	for _, part := range quoted.Parts {
+		switch part := part.(type) {
+		case *Lit:
+			got = append(got, "lit:"+part.Value)
+		case *ParamExp:
+			got = append(got, "param:"+part.Param)
+		}
+	}
+	expected := []string{"lit:+", "param:LINENO", `lit: "x" \$y `, "param:z"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("ParseQuoted() parts = %q, want %q", got, expected)
+	}
+}
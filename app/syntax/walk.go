@@ -0,0 +1,58 @@
+package syntax
+
+// Walk traverses the syntax tree rooted at node in depth-first order.
+// It calls f for each node; if f returns false, the children of that node are skipped.
+// Comments are visited as Comment values before the statements they are attached to.
+func Walk(node Node, f func(Node) bool) {
+	if node == nil || !f(node) {
+		return
+	}
+
+	switch node := node.(type) {
+	case *File:
+		for _, stmt := range node.Stmts {
+			Walk(stmt, f)
+		}
+		for _, c := range node.Last {
+			Walk(c, f)
+		}
+	case *Stmt:
+		for _, c := range node.Comments {
+			Walk(c, f)
+		}
+		if node.Time != nil {
+			Walk(node.Time, f)
+		}
+		if node.Coproc != nil {
+			Walk(node.Coproc, f)
+		}
+		if node.Cmd != nil {
+			Walk(node.Cmd, f)
+		}
+		for _, r := range node.Redirs {
+			Walk(r, f)
+		}
+		if node.Trailing != nil {
+			Walk(*node.Trailing, f)
+		}
+	case *CallExpr:
+		for _, arg := range node.Args {
+			Walk(arg, f)
+		}
+	case *Redirect:
+		if node.N != nil {
+			Walk(node.N, f)
+		}
+		if node.Word != nil {
+			Walk(node.Word, f)
+		}
+	case *Word:
+		for _, part := range node.Parts {
+			Walk(part, f)
+		}
+	case *DblQuoted:
+		for _, part := range node.Parts {
+			Walk(part, f)
+		}
+	}
+}
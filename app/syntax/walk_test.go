@@ -0,0 +1,68 @@
+package syntax
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWalk(t *testing.T) {
+	file, err := Parse("# top\necho \"hi $USER\" 2>err.log # tail\n", "")
+	if err != nil {
+		t.Fatalf("Parse() error: %v", err)
+	}
+
+	var kinds []string
+	Walk(file, func(node Node) bool {
+		switch node := node.(type) {
+		case *File:
+			kinds = append(kinds, "File")
+		case *Stmt:
+			kinds = append(kinds, "Stmt")
+		case Comment:
+			kinds = append(kinds, "Comment:"+node.Text)
+		case *CallExpr:
+			kinds = append(kinds, "CallExpr")
+		case *Word:
+			kinds = append(kinds, "Word")
+		case *Lit:
+			kinds = append(kinds, "Lit:"+node.Value)
+		case *DblQuoted:
+			kinds = append(kinds, "DblQuoted")
+		case *ParamExp:
+			kinds = append(kinds, "ParamExp:"+node.Param)
+		case *Redirect:
+			kinds = append(kinds, "Redirect:"+node.Op.String())
+		}
+		return true
+	})
+
+	expected := []string{
+		"File", "Stmt", "Comment: top", "CallExpr",
+		"Word", "Lit:echo",
+		"Word", "DblQuoted", "Lit:hi ", "ParamExp:USER",
+		"Redirect:>", "Lit:2", "Word", "Lit:err.log",
+		"Comment: tail",
+	}
+	if !reflect.DeepEqual(kinds, expected) {
+		t.Errorf("Walk() visited %v, want %v", kinds, expected)
+	}
+}
+
+func TestWalkSkipsChildren(t *testing.T) {
+	file, err := Parse("echo a b c\n", "")
+	if err != nil {
+		t.Fatalf("Parse() error: %v", err)
+	}
+
+	words := 0
+	Walk(file, func(node Node) bool {
+		if _, ok := node.(*Word); ok {
+			words++
+		}
+		_, isCall := node.(*CallExpr)
+		return !isCall
+	})
+	if words != 0 {
+		t.Errorf("expected children of CallExpr to be skipped, visited %d words", words)
+	}
+}